@@ -0,0 +1,117 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/karlsburg87/statusSentry/pkg/jsonpath"
+)
+
+//Assertions are the rules the response to a PollPage check must meet to pass. Every rule given must hold
+type Assertions struct {
+	//Status are the accepted status codes as single codes "204", ranges "200-299" or classes "2xx".
+	// Combined with PollPage.ExpectedStatus. Any 2xx or 3xx code is accepted if neither is given
+	Status []StatusRange `json:"status,omitempty"`
+	//BodyContains are keywords the response body must contain
+	BodyContains []string `json:"body_contains,omitempty"`
+	//BodyNotContains are keywords the response body must not contain
+	BodyNotContains []string `json:"body_not_contains,omitempty"`
+	//BodyMatches are regular expressions the response body must match
+	BodyMatches []string `json:"body_matches,omitempty"`
+	//BodyNotMatches are regular expressions the response body must not match
+	BodyNotMatches []string `json:"body_not_matches,omitempty"`
+	//JSONPath are values that must be found at JSONPath expressions within a JSON response body
+	JSONPath []JSONPathAssertion `json:"json_path,omitempty"`
+	//MaxResponseTime is the longest the whole response may take
+	MaxResponseTime Frequency `json:"max_response_time,omitempty"`
+	//MinCertDaysRemaining is the fewest days the server certificate may have left before it expires
+	MinCertDaysRemaining int `json:"min_cert_days_remaining,omitempty"`
+}
+
+//JSONPathAssertion is a value that must be found at a JSONPath expression such as $.status.indicator
+type JSONPathAssertion struct {
+	Path   string      `json:"path"`
+	Equals interface{} `json:"equals"`
+}
+
+//StatusRange is an accepted status code, range or class such as "204", "200-299" or "2xx"
+type StatusRange string
+
+//Bounds returns the inclusive lowest and highest status codes of the StatusRange
+func (sr StatusRange) Bounds() (low, high int, err error) {
+	raw := strings.ToLower(strings.TrimSpace(string(sr)))
+	switch {
+	case len(raw) == 3 && strings.HasSuffix(raw, "xx"):
+		class, err := strconv.Atoi(raw[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, fmt.Errorf("status class %q must be one of 1xx to 5xx", sr)
+		}
+		return class * 100, class*100 + 99, nil
+	case strings.Contains(raw, "-"):
+		parts := strings.SplitN(raw, "-", 2)
+		low, errLow := strconv.Atoi(strings.TrimSpace(parts[0]))
+		high, errHigh := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errLow != nil || errHigh != nil || low > high {
+			return 0, 0, fmt.Errorf("status range %q must be of the form 200-299", sr)
+		}
+		return low, high, validStatusBounds(sr, low, high)
+	default:
+		code, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, 0, fmt.Errorf("status %q must be a code, range or class e.g. 204, 200-299 or 2xx", sr)
+		}
+		return code, code, validStatusBounds(sr, code, code)
+	}
+}
+
+//validStatusBounds checks low and high are HTTP status codes
+func validStatusBounds(sr StatusRange, low, high int) error {
+	if low < 100 || high > 599 {
+		return fmt.Errorf("status %q is outside of the HTTP status codes", sr)
+	}
+	return nil
+}
+
+//Contains reports whether statusCode is within the StatusRange. Invalid ranges contain nothing
+func (sr StatusRange) Contains(statusCode int) bool {
+	low, high, err := sr.Bounds()
+	return err == nil && statusCode >= low && statusCode <= high
+}
+
+//HasBodyRules reports whether any of the Assertions need the response body
+func (assertions *Assertions) HasBodyRules() bool {
+	return assertions != nil && len(assertions.BodyContains)+len(assertions.BodyNotContains)+
+		len(assertions.BodyMatches)+len(assertions.BodyNotMatches)+len(assertions.JSONPath) > 0
+}
+
+//Validate returns every problem with the Assertions such as unparsable ranges, regular expressions or JSONPaths
+func (assertions *Assertions) Validate() []error {
+	out := make([]error, 0)
+	if assertions == nil {
+		return out
+	}
+	for _, sr := range assertions.Status {
+		if _, _, err := sr.Bounds(); err != nil {
+			out = append(out, err)
+		}
+	}
+	for _, expr := range append(append([]string{}, assertions.BodyMatches...), assertions.BodyNotMatches...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			out = append(out, fmt.Errorf("body regular expression %q does not compile: %v", expr, err))
+		}
+	}
+	for _, jp := range assertions.JSONPath {
+		if _, err := jsonpath.Parse(jp.Path); err != nil {
+			out = append(out, err)
+		}
+	}
+	if assertions.MaxResponseTime < 0 {
+		out = append(out, fmt.Errorf("max_response_time must be positive"))
+	}
+	if assertions.MinCertDaysRemaining < 0 {
+		out = append(out, fmt.Errorf("min_cert_days_remaining must be positive"))
+	}
+	return out
+}
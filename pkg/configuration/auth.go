@@ -0,0 +1,99 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+//SecretRef points to a secret value so it never appears in the config: "env:NAME" reads the env var NAME
+// and "file:/path" reads the file at /path, without any trailing new line
+type SecretRef string
+
+//Resolve returns the secret value SecretRef points to. The value is never part of the error
+func (ref SecretRef) Resolve() (string, error) {
+	kind, source, _ := strings.Cut(string(ref), ":")
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			return "", fmt.Errorf("secret env var %s is not set", source)
+		}
+		return value, nil
+	case "file":
+		value, err := os.ReadFile(source)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file: %v", err)
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+	return "", fmt.Errorf("secret must be referenced as env:NAME or file:/path")
+}
+
+//validate checks the SecretRef is of the form env:NAME or file:/path. Literal secrets are refused
+func (ref SecretRef) validate(field string) error {
+	kind, source, _ := strings.Cut(string(ref), ":")
+	if (kind != "env" && kind != "file") || source == "" {
+		return fmt.Errorf("auth %s must reference its secret as env:NAME or file:/path", field)
+	}
+	return nil
+}
+
+//PageAuth are the credentials sent with the requests of an http or synthetic PollPage. Every secret is a SecretRef
+type PageAuth struct {
+	//Username and Password are sent as basic auth
+	Username string    `json:"username,omitempty"`
+	Password SecretRef `json:"password,omitempty"`
+	//Bearer is sent as an Authorization: Bearer token
+	Bearer SecretRef `json:"bearer,omitempty"`
+	//Headers are request headers with secret values such as an API key
+	Headers map[string]SecretRef `json:"headers,omitempty"`
+	//ClientCert and ClientKey are the PEM certificate and key presented for mTLS
+	ClientCert SecretRef `json:"client_cert,omitempty"`
+	ClientKey  SecretRef `json:"client_key,omitempty"`
+	//CABundle are PEM certificates trusted to sign the server certificate on top of the system roots
+	CABundle SecretRef `json:"ca_bundle,omitempty"`
+}
+
+//HasTLS reports whether the PageAuth changes the TLS setup of the client with a client certificate or CA bundle
+func (auth *PageAuth) HasTLS() bool {
+	return auth != nil && (auth.ClientCert != "" || auth.CABundle != "")
+}
+
+//Validate returns every problem with the PageAuth
+func (auth *PageAuth) Validate() []error {
+	out := make([]error, 0)
+	if auth == nil {
+		return out
+	}
+	refs := []struct {
+		field string
+		ref   SecretRef
+	}{{"password", auth.Password}, {"bearer", auth.Bearer}, {"client_cert", auth.ClientCert}, {"client_key", auth.ClientKey}, {"ca_bundle", auth.CABundle}}
+	for _, ref := range refs {
+		if ref.ref == "" {
+			continue
+		}
+		if err := ref.ref.validate(ref.field); err != nil {
+			out = append(out, err)
+		}
+	}
+	for name, ref := range auth.Headers {
+		if !isHTTPToken(name) {
+			out = append(out, fmt.Errorf("auth header name %q is not valid", name))
+		}
+		if err := ref.validate("header " + name); err != nil {
+			out = append(out, err)
+		}
+	}
+	if (auth.Username == "") != (auth.Password == "") {
+		out = append(out, fmt.Errorf("auth username and password must be given together"))
+	}
+	if auth.Password != "" && auth.Bearer != "" {
+		out = append(out, fmt.Errorf("auth can have only one of basic and bearer"))
+	}
+	if (auth.ClientCert == "") != (auth.ClientKey == "") {
+		out = append(out, fmt.Errorf("auth client_cert and client_key must be given together"))
+	}
+	return out
+}
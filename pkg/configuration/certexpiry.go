@@ -0,0 +1,68 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+)
+
+//DefaultCertExpiryDays are the days before expiry a CertExpiry event is sent at if a Config has no CertExpiryDays
+var DefaultCertExpiryDays = []int{30, 14, 7, 1}
+
+//ExpiryThresholds returns the CertExpiryDays of the Config, or DefaultCertExpiryDays, from the most days to the least
+func (config Config) ExpiryThresholds() []int {
+	days := config.CertExpiryDays
+	if len(days) == 0 {
+		days = DefaultCertExpiryDays
+	}
+	out := append([]int(nil), days...)
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out
+}
+
+//CertExpiry is the event sent when a TLS certificate of a PollPage crosses one of the Config.CertExpiryDays.
+//
+//It is sent once for each threshold of each certificate. A certificate first seen past several thresholds is sent for the nearest
+type CertExpiry struct {
+	ServiceName string `json:"service_name"`
+	CheckID     string `json:"check_id"`
+	URL         string `json:"url"`
+	Subject     string `json:"cert_subject"`
+	Issuer      string `json:"cert_issuer"`
+	Fingerprint string `json:"cert_fingerprint_sha256"` //Fingerprint is the hex SHA-256 of the certificate
+	ValidUntil  string `json:"cert_valid_until"`        //ValidUntil is when the certificate expires in RFC3339 format
+	//DaysRemaining is the whole days left before the certificate expires. Negative once it has expired
+	DaysRemaining int `json:"days_remaining"`
+	//Threshold is the Config.CertExpiryDays threshold that was crossed
+	Threshold int    `json:"threshold_days"`
+	Time      string `json:"time"` //Time is when the threshold crossing was seen in RFC3339 format
+}
+
+//ToTransport for CertExpiry to implement Transports
+func (expiry CertExpiry) ToTransport(conf Config) (Transporter, error) {
+	return Transporter{
+		EventType:                EventCertExpiry,
+		DisplayServiceName:       conf.ServiceName,
+		DisplayDomain:            conf.DisplayDomain,
+		Message:                  expiry.String(),
+		MessagePublishedDateTime: expiry.Time,
+		CertExpiry:               &expiry,
+		MetaStatusPage:           conf.StatusPage,
+	}, nil
+}
+
+//Send for CertExpiry to implement Transports
+func (expiry CertExpiry) Send(conf Config, sender chan<- Transporter) error {
+	transport, err := expiry.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
+
+func (expiry CertExpiry) String() string {
+	if expiry.DaysRemaining < 0 {
+		return fmt.Sprintf("%s (%s) certificate %s expired on %s", expiry.ServiceName, expiry.URL, expiry.Subject, expiry.ValidUntil)
+	}
+	return fmt.Sprintf("%s (%s) certificate %s expires in %d days on %s", expiry.ServiceName, expiry.URL, expiry.Subject, expiry.DaysRemaining, expiry.ValidUntil)
+}
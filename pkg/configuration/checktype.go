@@ -0,0 +1,140 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+//CheckType is the kind of check run for a PollPage, selected by the scheme of its URL
+type CheckType string
+
+const (
+	//CheckHTTP is an http:// or https:// request to the page
+	CheckHTTP CheckType = "http"
+	//CheckTCP is a TCP connect to tcp://host:port timing the connection
+	CheckTCP CheckType = "tcp"
+	//CheckDNS is a resolution of dns://name?type=A&expect=1.2.3.4 or, with a given nameserver, dns://server:53/name?type=A
+	CheckDNS CheckType = "dns"
+	//CheckEcho is an unprivileged echo ping of echo://host:port?network=udp (default) or network=tcp
+	CheckEcho CheckType = "echo"
+)
+
+//defaultEchoPort is the port of the echo protocol (RFC 862) used if an echo URL has none
+const defaultEchoPort = "7"
+
+//dnsRecordTypes are the supported record types of a CheckDNS
+var dnsRecordTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "TXT": true}
+
+//CheckType returns the kind of check for the page from the scheme of its URL. Unknown schemes are returned as is
+func (page PollPage) CheckType() CheckType {
+	scheme := page.URL
+	if i := strings.Index(scheme, "://"); i >= 0 {
+		scheme = strings.ToLower(scheme[:i])
+	}
+	if scheme == "http" || scheme == "https" {
+		return CheckHTTP
+	}
+	return CheckType(scheme)
+}
+
+//TCPAddress returns the host:port to connect to for a CheckTCP page
+func (page PollPage) TCPAddress() (string, error) {
+	uri, err := url.Parse(page.URL)
+	if err != nil {
+		return "", fmt.Errorf("malformed URL %q: %v", page.URL, err)
+	}
+	if uri.Hostname() == "" || uri.Port() == "" {
+		return "", fmt.Errorf("tcp URL %q must be of the form tcp://host:port", page.URL)
+	}
+	return uri.Host, nil
+}
+
+//EchoTarget returns the network, udp or tcp, and the host:port to ping for a CheckEcho page
+func (page PollPage) EchoTarget() (network, address string, err error) {
+	uri, err := url.Parse(page.URL)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed URL %q: %v", page.URL, err)
+	}
+	if uri.Hostname() == "" {
+		return "", "", fmt.Errorf("echo URL %q has no host", page.URL)
+	}
+	network = strings.ToLower(uri.Query().Get("network"))
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp":
+	default:
+		return "", "", fmt.Errorf("echo URL %q network must be udp or tcp", page.URL)
+	}
+	port := uri.Port()
+	if port == "" {
+		port = defaultEchoPort
+	}
+	return network, net.JoinHostPort(uri.Hostname(), port), nil
+}
+
+//DNSQuery is the resolution made by a CheckDNS page
+type DNSQuery struct {
+	Server string   //Server is the host:port of the nameserver to ask. Empty for the system resolver
+	Name   string   //Name is the domain name to resolve
+	Type   string   //Type is the record type, one of A, AAAA, CNAME, MX, NS or TXT. Defaults to A
+	Expect []string //Expect are values that must all be in the answer. Any answer passes if empty
+}
+
+//DNSQuery returns the query of a CheckDNS page.
+//
+//The expected values are given as repeated or comma separated expect parameters
+func (page PollPage) DNSQuery() (DNSQuery, error) {
+	uri, err := url.Parse(page.URL)
+	if err != nil {
+		return DNSQuery{}, fmt.Errorf("malformed URL %q: %v", page.URL, err)
+	}
+	query := DNSQuery{Name: uri.Host, Type: strings.ToUpper(uri.Query().Get("type"))}
+	if path := strings.Trim(uri.Path, "/"); path != "" {
+		query.Server, query.Name = uri.Host, path
+		if _, _, err := net.SplitHostPort(query.Server); err != nil {
+			query.Server = net.JoinHostPort(query.Server, "53")
+		}
+	}
+	if query.Name == "" {
+		return DNSQuery{}, fmt.Errorf("dns URL %q has no name to resolve", page.URL)
+	}
+	if query.Type == "" {
+		query.Type = "A"
+	}
+	if !dnsRecordTypes[query.Type] {
+		return DNSQuery{}, fmt.Errorf("dns URL %q record type %q is not one of A, AAAA, CNAME, MX, NS or TXT", page.URL, query.Type)
+	}
+	for _, values := range uri.Query()["expect"] {
+		for _, value := range strings.Split(values, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				query.Expect = append(query.Expect, value)
+			}
+		}
+	}
+	return query, nil
+}
+
+//validateCheckURL checks the URL of page is valid for its CheckType
+func validateCheckURL(page PollPage) error {
+	var err error
+	switch page.CheckType() {
+	case CheckHTTP:
+		err = validateHTTPURL(page.URL)
+	case CheckTCP:
+		_, err = page.TCPAddress()
+	case CheckDNS:
+		_, err = page.DNSQuery()
+	case CheckEcho:
+		_, _, err = page.EchoTarget()
+	case CheckSynthetic:
+		if !strings.HasPrefix(page.URL, "synthetic://") || len(page.URL) == len("synthetic://") {
+			err = fmt.Errorf("synthetic URL %q must be of the form synthetic://name", page.URL)
+		}
+	default:
+		err = fmt.Errorf("URL %q must use one of the http, https, tcp, dns, echo or synthetic schemes", page.URL)
+	}
+	return err
+}
@@ -23,7 +23,7 @@ func (freq *Frequency) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
-	freq = (*Frequency)(&fq)
+	*freq = Frequency(fq)
 	return nil
 }
 
@@ -35,6 +35,8 @@ const (
 	ServiceRSS     ServiceType = "rss"
 	ServiceEmail   ServiceType = "email"
 	ServiceTwitter ServiceType = "twitter"
+	//ServiceStatuspage is an Atlassian Statuspage read from its API at statuspage:https://status.example.com
+	ServiceStatuspage ServiceType = "statuspage"
 )
 
 //Configuration is the input to the application of various configs that can be interpreted by the application
@@ -66,16 +68,34 @@ type Config struct {
 	//
 	//- rss:https://websitefeed.com/rss (page to fetch feed from)
 	//
+	//- statuspage:https://status.example.com (Atlassian Statuspage to read incidents and components from)
+	//
 	//- email:salesforce-status-alert@salesforce.com (incoming email address to look for)
 	//
-	//- webhook:/endpoint/path (path to look for at webhook endpoint)
+	//- webhook:/endpoint/path (path to look for at webhook endpoint), optionally after a payload format
+	// as in webhook:statuspage or webhook:incidentio/endpoint/path. See WebhookSource
 	TargetHook string `json:"status_source,omitempty"`
 	//PollFrequency is the frequency with which to fetch an update. In Go duration string format when JSON marshalled: e.g. "1m","2h4m13s",etc
 	PollFrequency Frequency `json:"poll_frequency"`
 	//PollPages are the pages within the sub domain with which to poll for uptime and record response times
 	//
-	//Each one will return a PingResponse when conducted every Config.Frequency time period
-	PollPages []string `json:"poll_pages"`
+	//Each one will return a PingResponse when conducted every Config.Frequency time period.
+	// Each is either a plain URL string or a PollPage object with per page method, headers, body, timeout,
+	// expected status codes, frequency and tags
+	PollPages []PollPage `json:"poll_pages"`
+	//SLOTarget is the availability the service is expected to meet as a percentage e.g. 99.9. Optional
+	//
+	//SLA reports of the service say whether the target was met
+	SLOTarget float64 `json:"slo_target,omitempty"`
+	//CertExpiryDays are the days before a TLS certificate of the PollPages expires at which a CertExpiry event is sent.
+	// Defaults to DefaultCertExpiryDays
+	CertExpiryDays []int `json:"cert_expiry_days,omitempty"`
+	//DomainExpiryDays are the days before the registration of a domain of the Config expires at which a DomainExpiry event is sent.
+	// Defaults to DefaultDomainExpiryDays
+	DomainExpiryDays []int `json:"domain_expiry_days,omitempty"`
+	//InboundAuth are the signature, token, basic auth and IP checks updates pushed to the webhook and email
+	// endpoints for this Config must pass. Optional - updates are accepted from anyone knowing the ServiceName without it
+	InboundAuth *InboundAuth `json:"inbound_auth,omitempty"`
 
 	//latestFetch is the time of the last attempt to poll the pages in PollPages
 	latestFetch time.Time `json:"-"`
@@ -102,11 +122,16 @@ func (config *Config) SetFetchTime(t time.Time) {
 }
 
 //ParseServiceInfo parses and splits the TargetHook into the service type and raw targetHook string components
+//
+//A TargetHook without a service type prefix returns a blank ServiceType and the TargetHook unchanged
 func (config *Config) ParseServiceInfo() (serviceType ServiceType, plainTargetHook string) {
 	if config.plainTargetHook != "" && config.serviceType != "" {
 		return config.serviceType, config.plainTargetHook
 	}
 	prefixEnd := strings.Index(config.TargetHook, ":")
+	if prefixEnd < 0 {
+		return "", config.TargetHook
+	}
 	serviceType = ServiceType(strings.TrimSpace(strings.ToLower(config.TargetHook[:prefixEnd])))
 	plainTargetHook = config.TargetHook[prefixEnd+1:]
 	//log.Printf("service type: %s\nraw target hook: %s", serviceType, plainTargetHook)
@@ -119,25 +144,101 @@ type PingResponse struct {
 	//
 	//Metadata as application will read from TargetHook
 	StatusPage    string     `json:"-"`
-	ServiceName   string     `json:"-"`                   //ServiceName is taken from the Config instruction and is the readable name of a group of properties
-	Domain        string     `json:"-"`                   //Domain is taken from the Config instruction and is the readable domain under which PollPages are grouped
-	URL           string     `json:"pinged_url"`          //URL is the URL that was pinged
-	ResponseTimes PingTimes  `json:"ping_response_times"` //ResponseTime are the collection of http response times in milliseconds
-	StatusCode    int        `json:"ping_response_code"`  //StatusCode is the http status code 200 or 201 for OK and other RFC codes for various errors
-	ErrorText     string     `json:"ping_error"`          //ErrorText may be either the status code text description or the body of the response if exists and status code is not 200/201
-	Time          string     `json:"ping_time"`           //Time is the timestamp the ping was initiated at in RFC3339 format
-	Certificates  []PingCert `json:"ping_certs"`          //Certificates are the TLS certificate information of the response server as sent in the response of the ping
-	TimeGo        time.Time  `json:"-"`                   //TimeGo is Time but in usable format
+	ServiceName   string     `json:"-"`                    //ServiceName is taken from the Config instruction and is the readable name of a group of properties
+	Domain        string     `json:"-"`                    //Domain is taken from the Config instruction and is the readable domain under which PollPages are grouped
+	CheckID       string     `json:"check_id"`             //CheckID identifies the PollPage check that was run. See PollPage.CheckID
+	Tags          []string   `json:"check_tags,omitempty"` //Tags are the PollPage tags of the check
+	URL           string     `json:"pinged_url"`           //URL is the URL that was pinged
+	Method        string     `json:"ping_method"`          //Method is the HTTP method used for the ping
+	ResponseTimes PingTimes  `json:"ping_response_times"`  //ResponseTime are the collection of http response times in milliseconds
+	StatusCode    int        `json:"ping_response_code"`   //StatusCode is the http status code 200 or 201 for OK and other RFC codes for various errors
+	Passed        bool       `json:"ping_passed"`          //Passed is the verdict of the ping. True if the page responded without error and met every PollPage assertion
+	ErrorText     string     `json:"ping_error"`           //ErrorText may be either the status code text description or the body of the response if exists and status code is not 200/201
+	Time          string     `json:"ping_time"`            //Time is the timestamp the ping was initiated at in RFC3339 format
+	Certificates  []PingCert `json:"ping_certs"`           //Certificates are the TLS certificate information of the response server as sent in the response of the ping
+	TimeGo        time.Time  `json:"-"`                    //TimeGo is Time but in usable format
+
+	//FailedAssertions describes each PollPage assertion the response did not meet
+	FailedAssertions []string `json:"ping_failed_assertions,omitempty"`
+	//CheckType is the kind of check run. See PollPage.CheckType
+	CheckType CheckType `json:"check_type"`
+	//ResolvedAddresses are the answers of a dns check or the addresses a tcp or echo host resolved to
+	ResolvedAddresses []string `json:"resolved_addresses,omitempty"`
+	//ErrorCategory is the class of failure described by ErrorText. Empty if the check ran without error
+	ErrorCategory ErrorCategory `json:"ping_error_category,omitempty"`
+	//Attempts are the results of every try of a check that was retried on failure, first to last. See PollPage.Retries.
+	// The rest of the PingResponse is the last attempt
+	Attempts []PingAttempt `json:"ping_attempts,omitempty"`
+	//ScheduleDrift is how many milliseconds after it was due the check was started. High drift means the worker pool is too small
+	ScheduleDrift int64 `json:"schedule_drift_ms"`
+	//SkippedRuns is the number of runs of the check skipped since its last run because it was still running or the worker pool was busy
+	SkippedRuns int `json:"skipped_runs,omitempty"`
+	//TLS is the inspection of the TLS connection of an https check. Set for a failed handshake too where the server could be reached
+	TLS *TLSInfo `json:"tls,omitempty"`
+	//Warnings describe weak or invalid configuration found by the check, such as a weak certificate key. Warnings do not fail the check
+	Warnings []string `json:"ping_warnings,omitempty"`
+	//ContentHash is the hex SHA-256 of the watched content of a page with a ContentWatch
+	ContentHash string `json:"content_sha256,omitempty"`
+	//Content is the watched content hashed in ContentHash. Kept to diff against the next response
+	Content string `json:"-"`
+	//Steps are the results of each step of a synthetic check in order. Steps after a failed step are not run
+	Steps []StepResult `json:"ping_steps,omitempty"`
 }
 
-//PingTimes is the collection of http response times in milliseconds
+//PingAttempt is the result of a single try of a check that was retried
+type PingAttempt struct {
+	Time             string        `json:"time"` //Time is when the attempt started in RFC3339 format
+	Passed           bool          `json:"passed"`
+	StatusCode       int           `json:"status_code,omitempty"`
+	ErrorText        string        `json:"error,omitempty"`
+	ErrorCategory    ErrorCategory `json:"error_category,omitempty"`
+	FailedAssertions []string      `json:"failed_assertions,omitempty"`
+	ResponseTimes    PingTimes     `json:"response_times"`
+}
+
+//Attempt returns the PingAttempt summary of the ping
+func (ping PingResponse) Attempt() PingAttempt {
+	return PingAttempt{
+		Time:             ping.TimeGo.Format(time.RFC3339Nano),
+		Passed:           ping.Passed,
+		StatusCode:       ping.StatusCode,
+		ErrorText:        ping.ErrorText,
+		ErrorCategory:    ping.ErrorCategory,
+		FailedAssertions: ping.FailedAssertions,
+		ResponseTimes:    ping.ResponseTimes,
+	}
+}
+
+//ErrorCategory is the class of failure of a ping
+type ErrorCategory string
+
+const (
+	ErrorDNS     ErrorCategory = "dns"     //ErrorDNS is a failure to resolve the host such as NXDOMAIN
+	ErrorConnect ErrorCategory = "connect" //ErrorConnect is a failure to connect such as connection refused or no route to host
+	ErrorTLS     ErrorCategory = "tls"     //ErrorTLS is a failed TLS handshake or certificate verification
+	ErrorTimeout ErrorCategory = "timeout" //ErrorTimeout is the check taking longer than its timeout
+	ErrorReset   ErrorCategory = "reset"   //ErrorReset is the server resetting or closing the connection before a full response
+	ErrorHTTP    ErrorCategory = "http"    //ErrorHTTP is a malformed HTTP response or a status code that is not accepted
+)
+
+//PingTimes is the collection of http response times in milliseconds along with the connection they were measured on.
+//Phases a check did not go through, such as the TLS handshake of a plain http page, are zero
+//
+//tcp checks set DNS and Connect, dns checks set DNS and echo checks set DNS, Connect and RoundTrip. All set Total
 //
 //See https://stackoverflow.com/questions/48077098/getting-ttfb-time-to-first-byte-value-in-golang/48077762#48077762
 type PingTimes struct {
-	DNS           int64 `json:"dns"`
-	TLSHandshake  int64 `json:"tls_handshake"`
-	Connect       int64 `json:"connect"`
-	FirstResponse int64 `json:"first_response"`
+	DNS              int64  `json:"dns"`
+	TLSHandshake     int64  `json:"tls_handshake"`
+	Connect          int64  `json:"connect"`
+	FirstResponse    int64  `json:"first_response"`       //FirstResponse is kept for existing consumers and is the same as ServerProcessing
+	RequestWrite     int64  `json:"request_write"`        //RequestWrite is from getting a connection to writing the whole request
+	ServerProcessing int64  `json:"server_processing"`    //ServerProcessing is from writing the request to the first response byte (TTFB)
+	ContentTransfer  int64  `json:"content_transfer"`     //ContentTransfer is from the first response byte to the end of the body
+	Total            int64  `json:"total"`                //Total is the whole check from start to end
+	RoundTrip        int64  `json:"round_trip,omitempty"` //RoundTrip is the time for an echo check payload to come back
+	RemoteIP         string `json:"remote_ip,omitempty"`  //RemoteIP is the address connected to
+	Protocol         string `json:"protocol,omitempty"`   //Protocol is the HTTP version of the response such as HTTP/1.1 or HTTP/2.0, or the network of a tcp or echo check
 }
 
 type PingCert struct {
@@ -148,11 +249,37 @@ type PingCert struct {
 	Subject      string `json:"cert_subject"`     //Subject is common name of the entity to which this cert has been issued
 	IsExpired    bool   `json:"cert_expired"`     //IsExpired is if the server SSL certificate has expired
 
+	//KeyAlgorithm is the algorithm of the public key of the certificate: RSA, ECDSA or Ed25519
+	KeyAlgorithm string `json:"cert_key_algorithm,omitempty"`
+	//KeyBits is the size of the public key in bits
+	KeyBits int `json:"cert_key_bits,omitempty"`
+	//SignatureAlgorithm is the algorithm the issuer signed the certificate with such as SHA256-RSA
+	SignatureAlgorithm string `json:"cert_signature_algorithm,omitempty"`
+	//DNSNames are the subject alternative names of the certificate
+	DNSNames []string `json:"cert_dns_names,omitempty"`
+	//Fingerprint is the hex SHA-256 of the certificate
+	Fingerprint string `json:"cert_fingerprint_sha256,omitempty"`
+}
+
+//TLSInfo is the inspection of the TLS connection of an https check
+type TLSInfo struct {
+	Version     string `json:"tls_version"`      //Version is the negotiated TLS version such as TLS 1.3
+	CipherSuite string `json:"tls_cipher_suite"` //CipherSuite is the negotiated cipher suite
+	//ChainVerified is whether the certificate chain verifies against the system roots, or the CA bundle of the check if it has one
+	ChainVerified bool   `json:"chain_verified"`
+	ChainError    string `json:"chain_error,omitempty"` //ChainError is why the chain did not verify
+	//HostnameMatch is whether the host of the check is one of the subject alternative names of the leaf certificate
+	HostnameMatch bool `json:"hostname_match"`
+	//OCSPStapled is whether the server stapled an OCSP response to the handshake
+	OCSPStapled bool `json:"ocsp_stapled"`
+	//OCSPStatus is the certificate status of the stapled OCSP response: good, revoked, unknown or invalid. Empty if none was stapled
+	OCSPStatus string `json:"ocsp_status,omitempty"`
 }
 
 //ToTransport for pingResponse to implement Transports
 func (ping PingResponse) ToTransport(conf Config) (Transporter, error) {
 	return Transporter{
+		EventType:    EventPing,
 		PingResponse: &ping,
 	}, nil
 }
@@ -0,0 +1,414 @@
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testJSONConfig = `[
+ {
+  "service_name": "Stripe",
+  "service_domain": "stripe.com",
+  "status_source": "twitter:@stripestatus",
+  "poll_frequency": "1m0s",
+  "poll_pages": ["https://www.stripe.com"]
+ },
+ {
+  "service_name": "GoCardless",
+  "service_domain": "gocardless.com",
+  "status_source": "rss:https://www.gocardless-status.com/history.rss",
+  "poll_frequency": "5m",
+  "poll_pages": ["https://www.gocardless.com"]
+ }
+]`
+
+const testYAMLConfig = `
+- service_name: Stripe
+  service_domain: stripe.com
+  status_source: rss:https://status.stripe.com/history.rss
+  poll_frequency: 2m
+  poll_pages:
+    - https://www.stripe.com
+    - https://api.stripe.com
+- service_name: Paypal
+  service_domain: paypal.com
+  poll_frequency: 30s
+  poll_pages:
+    - https://www.paypal.com
+`
+
+func TestLoadMergesFileSources(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "base.json")
+	yamlPath := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(jsonPath, []byte(testJSONConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(yamlPath, []byte(testYAMLConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := Load(context.Background(), jsonPath+", file://"+filepath.ToSlash(yamlPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*conf) != 3 {
+		t.Fatalf("expected 3 merged entries, got %d: %+v", len(*conf), *conf)
+	}
+	stripe := (*conf)[0]
+	if stripe.ServiceName != "Stripe" || stripe.TargetHook != "rss:https://status.stripe.com/history.rss" {
+		t.Errorf("expected later Stripe entry to replace the earlier one in place, got %+v", stripe)
+	}
+	if time.Duration(stripe.PollFrequency) != 2*time.Minute {
+		t.Errorf("expected yaml poll_frequency of 2m, got %s", time.Duration(stripe.PollFrequency))
+	}
+	if len(stripe.PollPages) != 2 {
+		t.Errorf("expected 2 poll pages from yaml, got %d", len(stripe.PollPages))
+	}
+	if (*conf)[1].ServiceName != "GoCardless" || (*conf)[2].ServiceName != "Paypal" {
+		t.Errorf("unexpected merge order: %+v", *conf)
+	}
+}
+
+func TestLoadHTTPAndGCSSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write([]byte(testYAMLConfig))
+		case "/storage/v1/b/my-bucket/o/configs/services.json":
+			if r.URL.Query().Get("alt") != "media" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(testJSONConfig))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", server.URL)
+
+	conf, err := Load(context.Background(), server.URL+"/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*conf) != 2 || (*conf)[1].ServiceName != "Paypal" {
+		t.Errorf("unexpected config from http yaml source: %+v", *conf)
+	}
+
+	conf, err = Load(context.Background(), "gs://my-bucket/configs/services.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*conf) != 2 || time.Duration((*conf)[1].PollFrequency) != 5*time.Minute {
+		t.Errorf("unexpected config from gs source: %+v", *conf)
+	}
+
+	if _, err := Load(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("expected an error for a 404 config location")
+	}
+	if _, err := Load(context.Background(), "ftp://example.com/config.json"); err == nil {
+		t.Error("expected an error for an unregistered scheme")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	conf, err := FetchTestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("expected the test config to be valid: %v", err)
+	}
+
+	bad := Configuration{
+		{ServiceName: "", TargetHook: "rss:https://example.com/feed"},
+		{ServiceName: "Dupe", TargetHook: "carrierpigeon:coo", PollFrequency: Frequency(time.Minute), PollPages: []PollPage{{URL: "https://example.com"}}},
+		{ServiceName: "dupe ", TargetHook: "twitter:@dupe"},
+		{ServiceName: "No Prefix", TargetHook: "https://example.com/feed"},
+		{ServiceName: "Pages", PollFrequency: Frequency(-time.Minute), PollPages: []PollPage{{URL: "example.com/home"}, {URL: "https://"}}},
+		{ServiceName: "Hooks/Team", TargetHook: "webhook:endpoint"},
+		{ServiceName: "Nothing"},
+		{ServiceName: "Team Hooks", TargetHook: "webhook:statuspage/webhook/hooks/team"},
+	}
+	err = bad.Validate()
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError, got %T: %v", err, err)
+	}
+	expected := []FieldError{
+		{Index: 0, Field: "service_name"},
+		{Index: 1, Field: "status_source"},
+		{Index: 2, Field: "service_name"},
+		{Index: 3, Field: "status_source"},
+		{Index: 4, Field: "poll_frequency"},
+		{Index: 4, Field: "poll_pages[0]"},
+		{Index: 4, Field: "poll_pages[1]"},
+		{Index: 5, Field: "service_name"},
+		{Index: 5, Field: "status_source"},
+		{Index: 6, Field: "status_source"},
+		{Index: 7, Field: "status_source"},
+	}
+	if len(invalid.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(expected), len(invalid.Problems), invalid)
+	}
+	for i, problem := range invalid.Problems {
+		if problem.Index != expected[i].Index || problem.Field != expected[i].Field {
+			t.Errorf("problem %d: expected config[%d] %s, got %v", i, expected[i].Index, expected[i].Field, problem)
+		}
+	}
+
+	//ParseServiceInfo must not panic on a TargetHook without a prefix
+	item := Config{TargetHook: "no-prefix"}
+	if serviceType, hook := item.ParseServiceInfo(); serviceType != "" || hook != "no-prefix" {
+		t.Errorf("unexpected ParseServiceInfo result %q %q", serviceType, hook)
+	}
+}
+
+func TestDiffConfigurations(t *testing.T) {
+	old := &Configuration{
+		{ServiceName: "Stripe", TargetHook: "twitter:@stripestatus", PollFrequency: Frequency(time.Minute), PollPages: []PollPage{{URL: "https://www.stripe.com"}, {URL: "https://api.stripe.com"}}},
+		{ServiceName: "Paypal", TargetHook: "rss:https://www.paypal-status.com/feed/rss"},
+		{ServiceName: "Unchanged", PollFrequency: Frequency(time.Minute), PollPages: []PollPage{{URL: "https://example.com"}}},
+	}
+	new := &Configuration{
+		{ServiceName: "Stripe", TargetHook: "twitter:@stripestatus", PollFrequency: Frequency(2 * time.Minute), PollPages: []PollPage{{URL: "https://www.stripe.com"}, {URL: "https://dashboard.stripe.com"}}},
+		{ServiceName: "Unchanged", PollFrequency: Frequency(time.Minute), PollPages: []PollPage{{URL: "https://example.com"}}},
+		{ServiceName: "GoCardless", TargetHook: "rss:https://www.gocardless-status.com/history.rss"},
+	}
+	diff := DiffConfigurations(old, new)
+	if len(diff.Added) != 1 || diff.Added[0] != "GoCardless" {
+		t.Errorf("unexpected added services %q", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != "Paypal" {
+		t.Errorf("unexpected removed services %q", diff.Removed)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("expected only Stripe to change, got %+v", diff.Changed)
+	}
+	stripe := diff.Changed[0]
+	if !stripe.HasField("poll_frequency") || len(stripe.Fields) != 1 {
+		t.Errorf("expected only poll_frequency to change, got %q", stripe.Fields)
+	}
+	if len(stripe.AddedPages) != 1 || stripe.AddedPages[0] != "https://dashboard.stripe.com" {
+		t.Errorf("unexpected added pages %q", stripe.AddedPages)
+	}
+	if len(stripe.RemovedPages) != 1 || stripe.RemovedPages[0] != "https://api.stripe.com" {
+		t.Errorf("unexpected removed pages %q", stripe.RemovedPages)
+	}
+	if !DiffConfigurations(new, new).IsEmpty() {
+		t.Error("expected no diff between identical configurations")
+	}
+}
+
+func TestPollPageJSON(t *testing.T) {
+	raw := `["https://www.stripe.com", {"id":"stripe-api","url":"https://api.stripe.com/v1/health","method":"head","headers":{"X-Probe":"sentry"},"timeout":"5s","expected_status":[200,204],"frequency":"30s","tags":["api"]}]`
+	pages := make([]PollPage, 0)
+	if err := json.Unmarshal([]byte(raw), &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].URL != "https://www.stripe.com" || pages[0].HTTPMethod() != http.MethodGet {
+		t.Fatalf("unexpected plain page %+v", pages)
+	}
+	api := pages[1]
+	if api.HTTPMethod() != http.MethodHead || api.Headers["X-Probe"] != "sentry" || time.Duration(api.Timeout) != 5*time.Second {
+		t.Errorf("unexpected page object %+v", api)
+	}
+	if !api.IsExpectedStatus(204) || api.IsExpectedStatus(301) || !pages[0].IsExpectedStatus(301) || pages[0].IsExpectedStatus(404) {
+		t.Error("unexpected expected status results")
+	}
+	config := Config{ServiceName: "Stripe", PollFrequency: Frequency(time.Minute)}
+	if config.PageFrequency(api) != 30*time.Second || config.PageFrequency(pages[0]) != time.Minute {
+		t.Error("expected page frequency to override the config poll frequency")
+	}
+	if api.CheckID("Stripe") != "stripe-api" || pages[0].CheckID("Stripe") == pages[0].CheckID("Paypal") {
+		t.Error("unexpected check ids")
+	}
+
+	//plain pages marshal back to plain strings for backward compatibility
+	out, err := json.Marshal(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := make([]PollPage, 0)
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	if string(out[:25]) != `["https://www.stripe.com"` || again[1].Frequency != api.Frequency {
+		t.Errorf("unexpected round trip %s", out)
+	}
+
+	//assertion status ranges combine with expected_status and broken rules are all reported
+	assertions := &Assertions{Status: []StatusRange{"2xx", "418"}}
+	teapot := PollPage{URL: "https://example.com", ExpectedStatus: []int{301}, Assertions: assertions}
+	if !teapot.IsExpectedStatus(204) || !teapot.IsExpectedStatus(418) || !teapot.IsExpectedStatus(301) || teapot.IsExpectedStatus(302) {
+		t.Error("unexpected assertion status results")
+	}
+	broken := &Assertions{Status: []StatusRange{"6xx", "299-200", "abc"}, BodyMatches: []string{"("}, JSONPath: []JSONPathAssertion{{Path: "status"}}}
+	if problems := broken.Validate(); len(problems) != 5 {
+		t.Errorf("expected 5 assertion problems, got %v", problems)
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	query, err := PollPage{URL: "dns://1.1.1.1/example.com?type=mx&expect=mx1.example.com,mx2.example.com&expect=mx3.example.com"}.DNSQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Server != "1.1.1.1:53" || query.Name != "example.com" || query.Type != "MX" || len(query.Expect) != 3 {
+		t.Errorf("unexpected dns query %+v", query)
+	}
+	if query, _ := (PollPage{URL: "dns://example.com"}).DNSQuery(); query.Server != "" || query.Type != "A" {
+		t.Errorf("unexpected default dns query %+v", query)
+	}
+	if network, address, _ := (PollPage{URL: "echo://10.0.0.1"}).EchoTarget(); network != "udp" || address != "10.0.0.1:7" {
+		t.Errorf("unexpected echo target %s %s", network, address)
+	}
+
+	cases := map[string]CheckType{
+		"https://example.com":    CheckHTTP,
+		"HTTP://example.com":     CheckHTTP,
+		"tcp://db.internal:5432": CheckTCP,
+		"dns://example.com":      CheckDNS,
+		"echo://10.0.0.1:7":      CheckEcho,
+	}
+	for raw, checkType := range cases {
+		page := PollPage{URL: raw}
+		if page.CheckType() != checkType || len(validatePollPage(page)) != 0 {
+			t.Errorf("%s: expected a valid %s check, got %s %v", raw, checkType, page.CheckType(), validatePollPage(page))
+		}
+	}
+	for _, raw := range []string{"tcp://db.internal", "dns://example.com?type=SRV", "echo://10.0.0.1?network=icmp", "ftp://example.com"} {
+		if len(validatePollPage(PollPage{URL: raw})) == 0 {
+			t.Errorf("expected %s to be invalid", raw)
+		}
+	}
+}
+
+func TestSyntheticSteps(t *testing.T) {
+	page := PollPage{URL: "synthetic://login", Steps: []Step{
+		{Name: "login", URL: "https://example.com/login", Method: "POST", Extract: []Extraction{{Name: "token", JSONPath: "$.token"}, {Name: "user_id", Regex: `"id":(\d+)`}}},
+		{URL: "https://example.com/users/{{ user_id }}", Headers: map[string]string{"Authorization": "Bearer {{token}}"}},
+	}}
+	if page.CheckType() != CheckSynthetic || len(validatePollPage(page)) != 0 {
+		t.Fatalf("expected a valid synthetic check, got %s %v", page.CheckType(), validatePollPage(page))
+	}
+	step, err := page.Steps[1].Expand(map[string]string{"token": "abc", "user_id": "7"})
+	if err != nil || step.URL != "https://example.com/users/7" || step.Headers["Authorization"] != "Bearer abc" || page.Steps[1].Headers["Authorization"] != "Bearer {{token}}" {
+		t.Errorf("unexpected expanded step %+v: %v", step, err)
+	}
+	if _, err := page.Steps[1].Expand(map[string]string{"token": "abc"}); err == nil {
+		t.Error("expected a step with a value not extracted to fail to expand")
+	}
+
+	bad := []PollPage{
+		{URL: "synthetic://empty"},
+		{URL: "synthetic://", Steps: page.Steps},
+		{URL: "synthetic://order", Steps: []Step{page.Steps[1], page.Steps[0]}},
+		{URL: "synthetic://scheme", Steps: []Step{{URL: "tcp://db.internal:5432"}}},
+		{URL: "synthetic://extract", Steps: []Step{{URL: "https://example.com", Extract: []Extraction{{Name: "both", JSONPath: "$.a", Regex: "a"}}}}},
+	}
+	for _, page := range bad {
+		if len(validatePollPage(page)) == 0 {
+			t.Errorf("expected %s to be invalid", page.URL)
+		}
+	}
+}
+
+func TestPageAuthValidate(t *testing.T) {
+	good := PollPage{URL: "https://internal.example.com/health", Auth: &PageAuth{
+		Username: "monitor", Password: "env:HEALTH_PASSWORD", Headers: map[string]SecretRef{"X-Api-Key": "file:/run/secrets/api_key"},
+		ClientCert: "file:/run/secrets/client.pem", ClientKey: "file:/run/secrets/client.key", CABundle: "file:/etc/ssl/internal.pem",
+	}}
+	if errs := validatePollPage(good); len(errs) != 0 {
+		t.Errorf("expected valid auth, got %v", errs)
+	}
+	bad := map[string]PollPage{
+		"literal secret":          {URL: "https://example.com", Auth: &PageAuth{Bearer: "hunter2"}},
+		"password without user":   {URL: "https://example.com", Auth: &PageAuth{Password: "env:PASSWORD"}},
+		"basic and bearer":        {URL: "https://example.com", Auth: &PageAuth{Username: "u", Password: "env:PASSWORD", Bearer: "env:TOKEN"}},
+		"certificate without key": {URL: "https://example.com", Auth: &PageAuth{ClientCert: "file:/client.pem"}},
+		"tcp check":               {URL: "tcp://db.internal:5432", Auth: &PageAuth{Bearer: "env:TOKEN"}},
+	}
+	for name, page := range bad {
+		if len(validatePollPage(page)) == 0 {
+			t.Errorf("%s: expected invalid auth", name)
+		}
+	}
+	t.Setenv("TEST_SECRET", "s3cret")
+	if value, err := SecretRef("env:TEST_SECRET").Resolve(); err != nil || value != "s3cret" {
+		t.Errorf("unexpected secret %q: %v", value, err)
+	}
+}
+
+func TestInboundAuthValidate(t *testing.T) {
+	good := Configuration{
+		{ServiceName: "Vendor", TargetHook: "webhook:statuspage", InboundAuth: &InboundAuth{SignatureSecret: "env:VENDOR_KEY", SignatureHeader: "X-Hub-Signature-256", AllowIPs: []string{"203.0.113.0/24", "2001:db8::1"}}},
+		{ServiceName: "Mail", TargetHook: "email:alerts@example.com", InboundAuth: &InboundAuth{Username: "cloudmailin", Password: "file:/run/secrets/cloudmailin"}},
+	}
+	if err := good.Validate(); err != nil {
+		t.Errorf("expected valid inbound auth, got %v", err)
+	}
+	bad := map[string]Config{
+		"empty":                 {ServiceName: "Vendor", TargetHook: "webhook:", InboundAuth: &InboundAuth{}},
+		"literal secret":        {ServiceName: "Vendor", TargetHook: "webhook:", InboundAuth: &InboundAuth{Bearer: "hunter2"}},
+		"basic and bearer":      {ServiceName: "Vendor", TargetHook: "webhook:", InboundAuth: &InboundAuth{Username: "u", Password: "env:PASSWORD", Bearer: "env:TOKEN"}},
+		"header without secret": {ServiceName: "Vendor", TargetHook: "webhook:", InboundAuth: &InboundAuth{SignatureHeader: "X-Signature", Bearer: "env:TOKEN"}},
+		"bad ip":                {ServiceName: "Vendor", TargetHook: "webhook:", InboundAuth: &InboundAuth{AllowIPs: []string{"203.0.113"}}},
+		"pull source":           {ServiceName: "Vendor", TargetHook: "rss:https://example.com/feed", InboundAuth: &InboundAuth{Bearer: "env:TOKEN"}},
+	}
+	for name, config := range bad {
+		if err := (Configuration{config}).Validate(); err == nil {
+			t.Errorf("%s: expected invalid inbound auth", name)
+		}
+	}
+	auth := &InboundAuth{AllowIPs: []string{"203.0.113.0/24", "2001:db8::1"}}
+	for ip, want := range map[string]bool{"203.0.113.200": true, "198.51.100.1": false, "2001:db8::1": true, "2001:db8::2": false} {
+		if got := auth.AllowsIP(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: expected allowed %v, got %v", ip, want, got)
+		}
+	}
+}
+
+func TestWebhookSource(t *testing.T) {
+	cases := map[string]struct {
+		format WebhookFormat
+		path   string
+	}{
+		"webhook:/endpoint/path":          {WebhookRaw, "/endpoint/path"},
+		"webhook:statuspage":              {WebhookStatuspage, ""},
+		"webhook:IncidentIO/hooks/vendor": {WebhookIncidentIO, "/hooks/vendor"},
+		"webhook:":                        {WebhookRaw, ""},
+	}
+	for hook, want := range cases {
+		config := Config{ServiceName: "Vendor", TargetHook: hook}
+		if format, path := config.WebhookSource(); format != want.format || path != want.path {
+			t.Errorf("%s: expected %q %q, got %q %q", hook, want.format, want.path, format, path)
+		}
+		if err := (Configuration{config}).Validate(); err != nil {
+			t.Errorf("%s: expected a valid webhook source: %v", hook, err)
+		}
+	}
+	if err := (Configuration{{ServiceName: "Vendor", TargetHook: "webhook:pagerduty"}}).Validate(); err == nil {
+		t.Error("expected an unknown webhook format to be invalid")
+	}
+	bad := map[string]Configuration{
+		"reserved root":   {{ServiceName: "Vendor", TargetHook: "webhook:/"}},
+		"reserved email":  {{ServiceName: "Vendor", TargetHook: "webhook:statuspage/email/"}},
+		"duplicate paths": {{ServiceName: "One", TargetHook: "webhook:/hooks/vendor"}, {ServiceName: "Two", TargetHook: "webhook:instatus/hooks/vendor/"}},
+		"named route":     {{ServiceName: "Vendor", TargetHook: "webhook:statuspage"}, {ServiceName: "Other", TargetHook: "webhook:/Webhook/vendor/"}},
+	}
+	for name, configuration := range bad {
+		if err := configuration.Validate(); err == nil {
+			t.Errorf("%s: expected an invalid webhook path", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/karlsburg87/statusSentry/pkg/selector"
+)
+
+//ContentWatch opts a PollPage into content change detection. The watched content of each response is hashed and a
+// ContentChange is sent whenever it differs from the last response.
+//
+//The content is the text of the elements matching Selector, or the whole body without one, narrowed by Regex,
+// with every match of the Ignore patterns removed
+type ContentWatch struct {
+	//Selector is a CSS selector of the elements of an HTML page to watch e.g. "#banner, .incident". See package selector for the syntax supported
+	Selector string `json:"selector,omitempty"`
+	//Regex narrows the content to its matches, or to the first capture group of each match if it has one
+	Regex string `json:"regex,omitempty"`
+	//Ignore are patterns of dynamic content such as timestamps that are removed before the content is compared
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+//Validate returns every problem with the ContentWatch
+func (watch *ContentWatch) Validate() []error {
+	out := make([]error, 0)
+	if watch == nil {
+		return out
+	}
+	if watch.Selector != "" {
+		if _, err := selector.Parse(watch.Selector); err != nil {
+			out = append(out, fmt.Errorf("content %v", err))
+		}
+	}
+	for _, expr := range append([]string{watch.Regex}, watch.Ignore...) {
+		if expr == "" {
+			continue
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			out = append(out, fmt.Errorf("content pattern %q does not compile: %v", expr, err))
+		}
+	}
+	return out
+}
+
+//ContentChange is the event sent when the watched content of a PollPage differs from its last response
+type ContentChange struct {
+	ServiceName string `json:"service_name"`
+	CheckID     string `json:"check_id"`
+	URL         string `json:"url"`
+	OldHash     string `json:"old_content_sha256"`
+	NewHash     string `json:"new_content_sha256"`
+	//Diff lists the lines removed, prefixed "- ", and added, prefixed "+ ", from the old content to the new
+	Diff string `json:"diff"`
+	Time string `json:"time"` //Time is when the change was seen in RFC3339 format
+}
+
+//ToTransport for ContentChange to implement Transports
+func (change ContentChange) ToTransport(conf Config) (Transporter, error) {
+	return Transporter{
+		EventType:                EventContentChange,
+		DisplayServiceName:       conf.ServiceName,
+		DisplayDomain:            conf.DisplayDomain,
+		Message:                  change.String(),
+		RawMessage:               change.Diff,
+		MessagePublishedDateTime: change.Time,
+		ContentChange:            &change,
+		MetaStatusPage:           conf.StatusPage,
+	}, nil
+}
+
+//Send for ContentChange to implement Transports
+func (change ContentChange) Send(conf Config, sender chan<- Transporter) error {
+	transport, err := change.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
+
+func (change ContentChange) String() string {
+	return fmt.Sprintf("%s (%s) content changed", change.ServiceName, change.URL)
+}
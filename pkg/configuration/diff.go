@@ -0,0 +1,134 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//Diff is the set of changes between an old and a new Configuration keyed by ServiceName and PollPage.Key, the page URL unless an ID is given
+type Diff struct {
+	Added   []string      `json:"added"`   //Added are the ServiceNames only in the new Configuration
+	Removed []string      `json:"removed"` //Removed are the ServiceNames only in the old Configuration
+	Changed []ServiceDiff `json:"changed"` //Changed are the services in both Configurations whose entries differ
+}
+
+//ServiceDiff is the set of changes to a single Config entry found in both Configurations of a Diff
+type ServiceDiff struct {
+	ServiceName  string   `json:"service_name"`
+	Fields       []string `json:"fields,omitempty"`        //Fields are the JSON names of the changed fields other than poll_pages
+	AddedPages   []string `json:"added_pages,omitempty"`   //AddedPages are the PollPages keys only in the new entry
+	RemovedPages []string `json:"removed_pages,omitempty"` //RemovedPages are the PollPages keys only in the old entry
+	ChangedPages []string `json:"changed_pages,omitempty"` //ChangedPages are the PollPages keys in both entries whose check definitions differ
+}
+
+//HasField reports whether the field with the given JSON name changed
+func (sd ServiceDiff) HasField(field string) bool {
+	for _, f := range sd.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+//IsEmpty reports whether the Diff has no changes
+func (diff Diff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+func (diff Diff) String() string {
+	changed := make([]string, 0, len(diff.Changed))
+	for _, sd := range diff.Changed {
+		changed = append(changed, fmt.Sprintf("%s (fields %q, pages +%q -%q ~%q)", sd.ServiceName, sd.Fields, sd.AddedPages, sd.RemovedPages, sd.ChangedPages))
+	}
+	return fmt.Sprintf("added %q, removed %q, changed %v", diff.Added, diff.Removed, changed)
+}
+
+//DiffConfigurations compares old and new entry by entry using ServiceName as the key, and
+// the PollPages of entries in both by PollPage.Key. Either may be nil which is treated as an empty Configuration
+func DiffConfigurations(old, new *Configuration) Diff {
+	diff := Diff{Added: make([]string, 0), Removed: make([]string, 0), Changed: make([]ServiceDiff, 0)}
+	before := make(map[string]Config)
+	if old != nil {
+		for _, item := range *old {
+			before[item.ServiceName] = item
+		}
+	}
+	seen := make(map[string]bool)
+	if new != nil {
+		for _, item := range *new {
+			seen[item.ServiceName] = true
+			prev, ok := before[item.ServiceName]
+			if !ok {
+				diff.Added = append(diff.Added, item.ServiceName)
+				continue
+			}
+			if sd := diffConfig(prev, item); len(sd.Fields)+len(sd.AddedPages)+len(sd.RemovedPages)+len(sd.ChangedPages) > 0 {
+				diff.Changed = append(diff.Changed, sd)
+			}
+		}
+	}
+	for name := range before {
+		if !seen[name] {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+//diffConfig compares two entries with the same ServiceName
+func diffConfig(old, new Config) ServiceDiff {
+	sd := ServiceDiff{ServiceName: new.ServiceName}
+	//compare every field other than poll_pages through its JSON form so new Config fields are picked up automatically
+	oldFields, newFields := configFields(old), configFields(new)
+	for name, value := range newFields {
+		if prev, ok := oldFields[name]; !ok || string(prev) != string(value) {
+			sd.Fields = append(sd.Fields, name)
+		}
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			sd.Fields = append(sd.Fields, name)
+		}
+	}
+	sort.Strings(sd.Fields)
+
+	oldPages := make(map[string]PollPage)
+	for _, page := range old.PollPages {
+		oldPages[page.Key()] = page
+	}
+	for _, page := range new.PollPages {
+		prev, ok := oldPages[page.Key()]
+		if !ok {
+			sd.AddedPages = append(sd.AddedPages, page.Key())
+			continue
+		}
+		prevRaw, _ := json.Marshal(prev)
+		raw, _ := json.Marshal(page)
+		if string(prevRaw) != string(raw) {
+			sd.ChangedPages = append(sd.ChangedPages, page.Key())
+		}
+		delete(oldPages, page.Key())
+	}
+	for page := range oldPages {
+		sd.RemovedPages = append(sd.RemovedPages, page)
+	}
+	sort.Strings(sd.RemovedPages)
+	return sd
+}
+
+//configFields returns the JSON encoded fields of config other than poll_pages keyed by JSON name
+func configFields(config Config) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage)
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return out
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out
+	}
+	delete(out, "poll_pages")
+	return out
+}
@@ -0,0 +1,107 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+//DefaultDomainExpiryDays are the days before expiry a DomainExpiry event is sent at if a Config has no DomainExpiryDays
+var DefaultDomainExpiryDays = []int{60, 30, 14, 7, 1}
+
+//DomainExpiryThresholds returns the DomainExpiryDays of the Config, or DefaultDomainExpiryDays, from the most days to the least
+func (config Config) DomainExpiryThresholds() []int {
+	days := config.DomainExpiryDays
+	if len(days) == 0 {
+		days = DefaultDomainExpiryDays
+	}
+	out := append([]int(nil), days...)
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out
+}
+
+//Hosts returns the host names of the DisplayDomain and of every PollPage of the Config, or the record name of dns checks,
+// without duplicates. IP addresses are left out
+func (config Config) Hosts() []string {
+	out := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(host string) {
+		host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+		if !strings.Contains(host, ".") || seen[host] || net.ParseIP(host) != nil {
+			return
+		}
+		seen[host] = true
+		out = append(out, host)
+	}
+	//DisplayDomain may be a bare domain or a URL
+	if display, err := url.Parse(config.DisplayDomain); err == nil && display.Hostname() != "" {
+		add(display.Hostname())
+	} else {
+		add(config.DisplayDomain)
+	}
+	for _, page := range config.PollPages {
+		if page.CheckType() == CheckDNS {
+			if query, err := page.DNSQuery(); err == nil {
+				add(query.Name)
+			}
+			continue
+		}
+		for _, step := range page.Steps {
+			if target, err := url.Parse(step.URL); err == nil {
+				add(target.Hostname())
+			}
+		}
+		if target, err := url.Parse(page.URL); err == nil {
+			add(target.Hostname())
+		}
+	}
+	return out
+}
+
+//DomainExpiry is the event sent when the registration of a domain of a Config crosses one of the Config.DomainExpiryDays.
+//
+//It is sent once for each threshold of each registration. A renewed registration is followed afresh
+type DomainExpiry struct {
+	ServiceName string `json:"service_name"`
+	Domain      string `json:"domain"`              //Domain is the registered domain such as example.co.uk
+	Registrar   string `json:"registrar,omitempty"` //Registrar is the name of the registrar of the domain
+	ExpiresAt   string `json:"expires_at"`          //ExpiresAt is when the registration expires in RFC3339 format
+	//DaysRemaining is the whole days left before the registration expires. Negative once it has expired
+	DaysRemaining int `json:"days_remaining"`
+	//Threshold is the Config.DomainExpiryDays threshold that was crossed
+	Threshold int    `json:"threshold_days"`
+	Source    string `json:"source"` //Source is where the registration came from: rdap or whois
+	Time      string `json:"time"`   //Time is when the threshold crossing was seen in RFC3339 format
+}
+
+//ToTransport for DomainExpiry to implement Transports
+func (expiry DomainExpiry) ToTransport(conf Config) (Transporter, error) {
+	return Transporter{
+		EventType:                EventDomainExpiry,
+		DisplayServiceName:       conf.ServiceName,
+		DisplayDomain:            conf.DisplayDomain,
+		Message:                  expiry.String(),
+		MessagePublishedDateTime: expiry.Time,
+		DomainExpiry:             &expiry,
+		MetaStatusPage:           conf.StatusPage,
+	}, nil
+}
+
+//Send for DomainExpiry to implement Transports
+func (expiry DomainExpiry) Send(conf Config, sender chan<- Transporter) error {
+	transport, err := expiry.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
+
+func (expiry DomainExpiry) String() string {
+	if expiry.DaysRemaining < 0 {
+		return fmt.Sprintf("%s domain %s registration expired on %s", expiry.ServiceName, expiry.Domain, expiry.ExpiresAt)
+	}
+	return fmt.Sprintf("%s domain %s registration expires in %d days on %s", expiry.ServiceName, expiry.Domain, expiry.DaysRemaining, expiry.ExpiresAt)
+}
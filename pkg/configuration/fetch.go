@@ -1,21 +1,178 @@
 package configuration
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Format is the encoding of a configuration Document
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
 )
 
+//Document is a raw configuration file as fetched from a single Source
+type Document struct {
+	Location     string //Location is the URI the document was fetched from
+	Format       Format //Format is the encoding of Raw - JSON or YAML
+	Raw          []byte //Raw is the undecoded file content
+	ETag         string //ETag is the version tag of the document given by the Source if any. Used for conditional refetching
+	LastModified string //LastModified is the modification time of the document given by the Source if any. Used for conditional refetching
+}
+
+//Load fetches the configuration from each comma separated location in locations, decodes them
+// from JSON or YAML and merges them into a single Configuration in the order given
+func Load(ctx context.Context, locations string) (*Configuration, error) {
+	out, _, err := LoadDocuments(ctx, locations)
+	return out, err
+}
+
+//LoadDocuments is Load that also returns the fetched Document of each location in order so they can be refetched conditionally
+func LoadDocuments(ctx context.Context, locations string) (*Configuration, []*Document, error) {
+	docs := make([]*Document, 0)
+	for _, location := range SplitLocations(locations) {
+		doc, err := Fetch(ctx, location)
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, nil, fmt.Errorf("no config location given")
+	}
+	out, err := Decode(docs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("new config loaded from %d source(s)", len(docs))
+	return out, docs, nil
+}
+
+//Hash returns a hex encoded SHA-256 hash of the JSON encoded Configuration.
+//
+//Configurations with the same content in the same order have the same hash regardless of their source format
+func (configuration Configuration) Hash() (string, error) {
+	raw, err := json.Marshal(configuration)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//SplitLocations splits a comma separated list of config locations such as the CONFIG_LOCATION envar
+func SplitLocations(locations string) []string {
+	out := make([]string, 0)
+	for _, location := range strings.Split(locations, ",") {
+		if location = strings.TrimSpace(location); location != "" {
+			out = append(out, location)
+		}
+	}
+	return out
+}
+
+//Decode decodes each Document and merges the results in order with Merge
+func Decode(docs ...*Document) (*Configuration, error) {
+	configurations := make([]Configuration, 0, len(docs))
+	for _, doc := range docs {
+		conf, err := doc.Decode()
+		if err != nil {
+			return nil, err
+		}
+		configurations = append(configurations, conf)
+	}
+	out := Merge(configurations...)
+	return &out, nil
+}
+
+//Decode decodes the raw Document content according to its Format.
+//
+//YAML is converted to JSON before decoding so both formats share the JSON field names and custom unmarshalers
+func (doc *Document) Decode() (Configuration, error) {
+	raw := doc.Raw
+	if doc.Format == FormatYAML {
+		var generic interface{}
+		if err := yaml.Unmarshal(doc.Raw, &generic); err != nil {
+			return nil, fmt.Errorf("yaml decode fail for config %q: %v", doc.Location, err)
+		}
+		var err error
+		if raw, err = json.Marshal(generic); err != nil {
+			return nil, fmt.Errorf("could not convert yaml config %q to json: %v", doc.Location, err)
+		}
+	}
+	out := make(Configuration, 0)
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("json decode fail for config %q: %v", doc.Location, err)
+	}
+	return out, nil
+}
+
+//Merge combines configurations into one in the order given.
+//
+//An entry with the same ServiceName as an entry from an earlier configuration replaces it in place
+func Merge(configurations ...Configuration) Configuration {
+	out := make(Configuration, 0)
+	index := make(map[string]int) //ServiceName against position in out
+	for _, conf := range configurations {
+		for _, item := range conf {
+			if i, ok := index[item.ServiceName]; ok {
+				out[i] = item
+				continue
+			}
+			index[item.ServiceName] = len(out)
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+//detectFormat works out the encoding of a config file from its file extension, then its content type and
+// finally by sniffing the content. Defaults to JSON
+func detectFormat(name, contentType string, raw []byte) Format {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	}
+	if strings.Contains(contentType, "yaml") {
+		return FormatYAML
+	}
+	if strings.Contains(contentType, "json") {
+		return FormatJSON
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '{' {
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+//FetchConfig fetches and decodes a single JSON or YAML configuration file over http(s) using client
 func FetchConfig(client *http.Client, configLocation string) (*Configuration, error) {
-	res, err := client.Get(configLocation)
+	uri, err := url.Parse(configLocation)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	var out *Configuration
-	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+	doc, err := HTTPSource{Client: client}.Fetch(context.Background(), uri)
+	if err != nil {
+		return nil, err
+	}
+	out, err := Decode(doc)
+	if err != nil {
 		return nil, err
 	}
 	log.Println("new config fetched from server")
@@ -31,7 +188,7 @@ func FetchTestConfig() (*Configuration, error) {
 			StatusPage:    "https://status.stripe.com/",
 			TargetHook:    "twitter:@stripestatus",
 			PollFrequency: Frequency(5 * time.Minute),
-			PollPages:     []string{"https://www.stripe.com"},
+			PollPages:     []PollPage{{URL: "https://www.stripe.com"}},
 		},
 		Config{
 			ServiceName:   "Paypal Services (incl. Braintree)",
@@ -39,7 +196,7 @@ func FetchTestConfig() (*Configuration, error) {
 			StatusPage:    "https://www.paypal-status.com/product/production",
 			TargetHook:    "rss:https://www.paypal-status.com/feed/rss",
 			PollFrequency: Frequency(5 * time.Minute),
-			PollPages:     []string{"https://www.paypal.com/uk/home", "https://www.braintreepayments.com/"},
+			PollPages:     []PollPage{{URL: "https://www.paypal.com/uk/home"}, {URL: "https://www.braintreepayments.com/"}},
 		},
 		Config{
 			ServiceName:   "Salesforce UK",
@@ -47,7 +204,7 @@ func FetchTestConfig() (*Configuration, error) {
 			StatusPage:    "https://status.salesforce.com/",
 			TargetHook:    "email:status_alerts@salesforce.com",
 			PollFrequency: Frequency(5 * time.Minute), //indicates instant
-			PollPages:     []string{"https://salesforce.com/uk"},
+			PollPages:     []PollPage{{URL: "https://salesforce.com/uk"}},
 		},
 		Config{
 			ServiceName:   "GoCardless",
@@ -55,7 +212,7 @@ func FetchTestConfig() (*Configuration, error) {
 			StatusPage:    "https://www.gocardless-status.com",
 			TargetHook:    "rss:https://www.gocardless-status.com/history.rss",
 			PollFrequency: Frequency(5 * time.Minute),
-			PollPages:     []string{"https://www.gocardless.com"},
+			PollPages:     []PollPage{{URL: "https://www.gocardless.com"}},
 		},
 		Config{
 			ServiceName:   "Atlassian - Jira",
@@ -63,7 +220,7 @@ func FetchTestConfig() (*Configuration, error) {
 			StatusPage:    "https://jira-software.status.atlassian.com",
 			TargetHook:    "rss:https://jira-software.status.atlassian.com/history.rss",
 			PollFrequency: Frequency(5 * time.Minute),
-			PollPages:     []string{"https://www.atlassian.com/software/jira"},
+			PollPages:     []PollPage{{URL: "https://www.atlassian.com/software/jira"}},
 		},
 	}, nil
 }
@@ -0,0 +1,117 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//DefaultSignatureHeader is the request header read for the HMAC signature of an InboundAuth without a SignatureHeader
+const DefaultSignatureHeader = "X-Signature-SHA256"
+
+//InboundAuth are the checks an update pushed to the webhook or email endpoints must pass for a Config.
+// Every check given must pass. Every secret is a SecretRef
+type InboundAuth struct {
+	//SignatureSecret is the key of the HMAC-SHA256 of the request body, sent hex encoded in SignatureHeader
+	// with or without a sha256= prefix
+	SignatureSecret SecretRef `json:"signature_secret,omitempty"`
+	//SignatureHeader is the request header holding the signature. Defaults to DefaultSignatureHeader
+	SignatureHeader string `json:"signature_header,omitempty"`
+	//Bearer is the token expected as Authorization: Bearer
+	Bearer SecretRef `json:"bearer,omitempty"`
+	//Username and Password are the expected basic auth as sent by cloudmailin
+	Username string    `json:"username,omitempty"`
+	Password SecretRef `json:"password,omitempty"`
+	//AllowIPs are the IPs or CIDR ranges updates may come from
+	AllowIPs []string `json:"allow_ips,omitempty"`
+	//TrustProxy reads the client IP from the last X-Forwarded-For entry, as added by a load balancer in front of the server
+	TrustProxy bool `json:"trust_proxy,omitempty"`
+}
+
+//Header returns the request header holding the HMAC signature
+func (auth *InboundAuth) Header() string {
+	if auth.SignatureHeader == "" {
+		return DefaultSignatureHeader
+	}
+	return http.CanonicalHeaderKey(auth.SignatureHeader)
+}
+
+//AllowsIP reports whether ip is in AllowIPs. Any IP is allowed when AllowIPs is empty
+func (auth *InboundAuth) AllowsIP(ip net.IP) bool {
+	if len(auth.AllowIPs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range auth.AllowIPs {
+		network, err := parseAllowIP(allowed)
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//parseAllowIP reads an AllowIPs entry as a network so a single IP is a network of one
+func parseAllowIP(raw string) (*net.IPNet, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "/") {
+		_, network, err := net.ParseCIDR(raw)
+		return network, err
+	}
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an IP or CIDR range", raw)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+//Validate returns every problem with the InboundAuth
+func (auth *InboundAuth) Validate() []error {
+	out := make([]error, 0)
+	if auth == nil {
+		return out
+	}
+	if auth.SignatureSecret == "" && auth.Bearer == "" && auth.Password == "" && len(auth.AllowIPs) == 0 {
+		out = append(out, fmt.Errorf("inbound_auth must have at least one of signature_secret, bearer, username and password or allow_ips"))
+	}
+	refs := []struct {
+		field string
+		ref   SecretRef
+	}{{"signature_secret", auth.SignatureSecret}, {"bearer", auth.Bearer}, {"password", auth.Password}}
+	for _, ref := range refs {
+		if ref.ref == "" {
+			continue
+		}
+		if err := ref.ref.validate(ref.field); err != nil {
+			out = append(out, err)
+		}
+	}
+	if auth.SignatureHeader != "" && !isHTTPToken(auth.SignatureHeader) {
+		out = append(out, fmt.Errorf("signature header name %q is not valid", auth.SignatureHeader))
+	}
+	if auth.SignatureHeader != "" && auth.SignatureSecret == "" {
+		out = append(out, fmt.Errorf("signature_header is given without a signature_secret"))
+	}
+	if (auth.Username == "") != (auth.Password == "") {
+		out = append(out, fmt.Errorf("inbound_auth username and password must be given together"))
+	}
+	if auth.Password != "" && auth.Bearer != "" {
+		out = append(out, fmt.Errorf("inbound_auth can have only one of basic and bearer as both use the Authorization header"))
+	}
+	for _, allowed := range auth.AllowIPs {
+		if _, err := parseAllowIP(allowed); err != nil {
+			out = append(out, fmt.Errorf("allow_ips entry %q is not an IP or CIDR range", allowed))
+		}
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package configuration
+
+import (
+	"fmt"
+)
+
+//Incident is an incident on a status page with its affected components and every update, read from a status page API or webhook.
+//
+//Sent as a status update with the Transporter Message the latest update
+type Incident struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`           //Status is the stage of the incident e.g. investigating, identified, monitoring or resolved
+	Impact string `json:"impact,omitempty"` //Impact is the severity e.g. none, minor, major or critical
+	URL    string `json:"url,omitempty"`
+
+	CreatedAt  string `json:"created_at,omitempty"` //CreatedAt and the other times are in RFC3339 format
+	UpdatedAt  string `json:"updated_at,omitempty"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+
+	Components []IncidentComponent `json:"components,omitempty"`
+	//Updates are the updates posted to the incident, latest first
+	Updates []IncidentUpdate `json:"updates,omitempty"`
+	//Source is where the incident came from e.g. statuspage
+	Source string `json:"source"`
+	//Raw is the incident as received
+	Raw string `json:"-"`
+}
+
+//IncidentComponent is a component of a status page affected by an Incident
+type IncidentComponent struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Group  string `json:"group,omitempty"`  //Group is the name of the group of components the component is in
+	Status string `json:"status,omitempty"` //Status is the current status e.g. operational, degraded_performance, partial_outage or major_outage
+}
+
+//IncidentUpdate is an update posted to an Incident
+type IncidentUpdate struct {
+	ID        string `json:"id,omitempty"`
+	Status    string `json:"status"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+//ToTransport for Incident to implement Transports
+func (incident Incident) ToTransport(conf Config) (Transporter, error) {
+	published := incident.UpdatedAt
+	if len(incident.Updates) > 0 {
+		published = incident.Updates[0].CreatedAt
+	}
+	return Transporter{
+		EventType:                EventStatusUpdate,
+		DisplayServiceName:       conf.ServiceName,
+		DisplayDomain:            conf.DisplayDomain,
+		Message:                  incident.String(),
+		RawMessage:               incident.Raw,
+		MessagePublishedDateTime: published,
+		Incident:                 &incident,
+		MetaStatusPage:           conf.StatusPage,
+	}, nil
+}
+
+//Send for Incident to implement Transports
+func (incident Incident) Send(conf Config, sender chan<- Transporter) error {
+	transport, err := incident.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
+
+//String returns the name and status of the incident with its latest update
+func (incident Incident) String() string {
+	out := fmt.Sprintf("%s - %s", incident.Name, incident.Status)
+	if len(incident.Updates) > 0 && incident.Updates[0].Body != "" {
+		out += ": " + incident.Updates[0].Body
+	}
+	return out
+}
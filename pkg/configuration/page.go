@@ -0,0 +1,150 @@
+package configuration
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//PollPage is a single check in Config.PollPages.
+//
+//In JSON it is either a plain URL string, which checks the page with a GET request using the defaults
+// of its Config, or an object with the URL and any of the optional fields below
+type PollPage struct {
+	//ID identifies the check in each PingResponse. Defaults to a hash of the ServiceName, Method and URL. See CheckID
+	ID string `json:"id,omitempty"`
+	//URL is the page to check
+	URL string `json:"url"`
+	//Method is the HTTP method of the check. Defaults to GET
+	Method string `json:"method,omitempty"`
+	//Headers are extra request headers sent with the check
+	Headers map[string]string `json:"headers,omitempty"`
+	//Body is the request body sent with the check
+	Body string `json:"body,omitempty"`
+	//Timeout is the maximum time the check may take. Defaults to the pinger client timeout
+	Timeout Frequency `json:"timeout,omitempty"`
+	//ExpectedStatus are the status codes that count as success. Defaults to any 2xx or 3xx status code
+	ExpectedStatus []int `json:"expected_status,omitempty"`
+	//Frequency overrides Config.PollFrequency for this page
+	Frequency Frequency `json:"frequency,omitempty"`
+	//Tags are free labels echoed in each PingResponse of the check
+	Tags []string `json:"tags,omitempty"`
+	//Assertions are further rules the response must meet to pass such as body keywords or a maximum response time
+	Assertions *Assertions `json:"assertions,omitempty"`
+	//State sets the failures it takes for the page to be DOWN and when it is flapping. See StatePolicy for the defaults
+	State *StatePolicy `json:"state,omitempty"`
+	//Retries is how many times a failed check is tried again straight away before it is reported as failed
+	Retries int `json:"retries,omitempty"`
+	//RetryDelay is the wait before each retry. Defaults to 2 seconds
+	RetryDelay Frequency `json:"retry_delay,omitempty"`
+	//Content opts the page into content change detection. See ContentWatch
+	Content *ContentWatch `json:"content,omitempty"`
+	//Auth are the credentials and client certificate sent with the requests of the page. See PageAuth
+	Auth *PageAuth `json:"auth,omitempty"`
+	//Steps are the requests of a synthetic:// page run in order as one transaction. See Step
+	Steps []Step `json:"steps,omitempty"`
+}
+
+//pollPage is PollPage without its custom JSON methods
+type pollPage PollPage
+
+//MarshalJSON encodes a PollPage as a plain URL string if only the URL is set to keep the original format
+func (page PollPage) MarshalJSON() ([]byte, error) {
+	if page.isPlain() {
+		return json.Marshal(page.URL)
+	}
+	return json.Marshal(pollPage(page))
+}
+
+//UnmarshalJSON decodes a PollPage from either a plain URL string or an object
+func (page *PollPage) UnmarshalJSON(b []byte) error {
+	var plainURL string
+	if err := json.Unmarshal(b, &plainURL); err == nil {
+		*page = PollPage{URL: plainURL}
+		return nil
+	}
+	var out pollPage
+	if err := json.Unmarshal(b, &out); err != nil {
+		return fmt.Errorf("poll page must be a URL string or an object: %v", err)
+	}
+	*page = PollPage(out)
+	return nil
+}
+
+//isPlain reports whether the PollPage has nothing set other than its URL
+func (page PollPage) isPlain() bool {
+	return page.ID == "" && page.Method == "" && len(page.Headers) == 0 && page.Body == "" && page.Timeout == 0 &&
+		len(page.ExpectedStatus) == 0 && page.Frequency == 0 && len(page.Tags) == 0 && page.Assertions == nil && page.State == nil &&
+		page.Retries == 0 && page.RetryDelay == 0 && page.Content == nil && len(page.Steps) == 0 && page.Auth == nil
+}
+
+//Key is the identity of the PollPage within its Config: the ID if given, otherwise the URL
+func (page PollPage) Key() string {
+	if page.ID != "" {
+		return page.ID
+	}
+	return page.URL
+}
+
+//HTTPMethod returns the upper cased Method, defaulting to GET
+func (page PollPage) HTTPMethod() string {
+	if page.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(page.Method)
+}
+
+//CheckID returns the ID of the check or, if not set, a stable ID derived from serviceName, the method and the URL
+func (page PollPage) CheckID(serviceName string) string {
+	if page.ID != "" {
+		return page.ID
+	}
+	sum := sha1.Sum([]byte(serviceName + "\n" + page.HTTPMethod() + "\n" + page.URL))
+	return hex.EncodeToString(sum[:6])
+}
+
+//IsExpectedStatus reports whether statusCode counts as a success for the page, being
+// in either ExpectedStatus or Assertions.Status. Any 2xx or 3xx code counts if neither is given
+func (page PollPage) IsExpectedStatus(statusCode int) bool {
+	var ranges []StatusRange
+	if page.Assertions != nil {
+		ranges = page.Assertions.Status
+	}
+	if len(page.ExpectedStatus) == 0 && len(ranges) == 0 {
+		return statusCode >= 200 && statusCode < 400
+	}
+	for _, code := range page.ExpectedStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	for _, sr := range ranges {
+		if sr.Contains(statusCode) {
+			return true
+		}
+	}
+	return false
+}
+
+//defaultRetryDelay is the wait before retrying a failed check if the PollPage has no RetryDelay
+const defaultRetryDelay = 2 * time.Second
+
+//RetryWait returns the wait before retrying a failed check of the page
+func (page PollPage) RetryWait() time.Duration {
+	if page.RetryDelay > 0 {
+		return time.Duration(page.RetryDelay)
+	}
+	return defaultRetryDelay
+}
+
+//PageFrequency returns how often page is to be checked: its own Frequency if set, otherwise the PollFrequency of config
+func (config Config) PageFrequency(page PollPage) time.Duration {
+	if page.Frequency > 0 {
+		return time.Duration(page.Frequency)
+	}
+	return time.Duration(config.PollFrequency)
+}
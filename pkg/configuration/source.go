@@ -0,0 +1,264 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+//Source fetches a raw configuration Document from a location of the scheme it is registered against
+type Source interface {
+	Fetch(ctx context.Context, location *url.URL) (*Document, error)
+}
+
+var (
+	sourcesMu sync.RWMutex
+	//sources is the directory of Source implementations keyed by URI scheme. A blank scheme is a plain file path
+	sources = map[string]Source{
+		"":      FileSource{},
+		"file":  FileSource{},
+		"http":  HTTPSource{},
+		"https": HTTPSource{},
+		"gs":    GCSSource{},
+	}
+)
+
+//ConditionalSource is a Source that can tell whether a Document has changed since it was last fetched
+type ConditionalSource interface {
+	Source
+	//FetchIfChanged returns the current Document at location or nil if it is unchanged since prev was fetched
+	FetchIfChanged(ctx context.Context, location *url.URL, prev *Document) (*Document, error)
+}
+
+//RegisterSource adds or replaces the Source used to fetch locations with the given URI scheme
+func RegisterSource(scheme string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[strings.ToLower(scheme)] = source
+}
+
+//Fetch resolves the Source for the scheme of location and fetches the raw configuration Document from it
+func Fetch(ctx context.Context, location string) (*Document, error) {
+	uri, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config location %q: %v", location, err)
+	}
+	sourcesMu.RLock()
+	source, ok := sources[strings.ToLower(uri.Scheme)]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no config source registered for scheme %q in location %q", uri.Scheme, location)
+	}
+	doc, err := source.Fetch(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch config from %q: %v", location, err)
+	}
+	return doc, nil
+}
+
+//Refetch fetches the Document at the location of prev again, returning changed as false and prev itself
+// if the Source reports the document is unchanged. Sources that are not a ConditionalSource are always refetched
+func Refetch(ctx context.Context, prev *Document) (doc *Document, changed bool, err error) {
+	uri, err := url.Parse(prev.Location)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not parse config location %q: %v", prev.Location, err)
+	}
+	sourcesMu.RLock()
+	source, ok := sources[strings.ToLower(uri.Scheme)]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, false, fmt.Errorf("no config source registered for scheme %q in location %q", uri.Scheme, prev.Location)
+	}
+	conditional, ok := source.(ConditionalSource)
+	if !ok {
+		doc, err := source.Fetch(ctx, uri)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not fetch config from %q: %v", prev.Location, err)
+		}
+		return doc, true, nil
+	}
+	doc, err = conditional.FetchIfChanged(ctx, uri, prev)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not fetch config from %q: %v", prev.Location, err)
+	}
+	if doc == nil {
+		return prev, false, nil
+	}
+	return doc, true, nil
+}
+
+//FileSource reads configuration files from the local filesystem.
+//
+//Accepts both file:///absolute/path URIs and plain relative or absolute file paths
+type FileSource struct{}
+
+//Fetch reads the file at location
+func (FileSource) Fetch(ctx context.Context, location *url.URL) (*Document, error) {
+	filePath := filePathFromURL(location)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		Location:     location.String(),
+		Format:       detectFormat(filePath, "", raw),
+		Raw:          raw,
+		ETag:         fileTag(info),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}, nil
+}
+
+//FetchIfChanged reads the file at location only if its modification time or size differ from when prev was read
+func (src FileSource) FetchIfChanged(ctx context.Context, location *url.URL, prev *Document) (*Document, error) {
+	info, err := os.Stat(filePathFromURL(location))
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.ETag == fileTag(info) {
+		return nil, nil
+	}
+	return src.Fetch(ctx, location)
+}
+
+//fileTag is the version tag of a local file made from its modification time and size
+func fileTag(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+//filePathFromURL returns the filesystem path of a file:// or scheme-less location
+func filePathFromURL(location *url.URL) string {
+	if location.Scheme == "" {
+		return location.Path
+	}
+	if location.Host != "" && location.Host != "localhost" { //file://relative/path.json
+		return filepath.FromSlash(location.Host + location.Path)
+	}
+	return filepath.FromSlash(location.Path)
+}
+
+//HTTPSource fetches configuration files with a GET request. Client defaults to a client with sensible timeouts
+type HTTPSource struct {
+	Client *http.Client
+}
+
+//Fetch gets the configuration file at location
+func (src HTTPSource) Fetch(ctx context.Context, location *url.URL) (*Document, error) {
+	client := src.Client
+	if client == nil {
+		client = newClient()
+	}
+	return fetchHTTP(ctx, client, location.String(), location.String(), nil)
+}
+
+//FetchIfChanged makes a conditional GET request for location using the ETag and LastModified of prev
+func (src HTTPSource) FetchIfChanged(ctx context.Context, location *url.URL, prev *Document) (*Document, error) {
+	client := src.Client
+	if client == nil {
+		client = newClient()
+	}
+	return fetchHTTP(ctx, client, location.String(), location.String(), prev)
+}
+
+//GCSSource fetches configuration objects from a Google Cloud Storage gs://bucket/object location via the JSON API.
+//
+//Uses Application Default Credentials where available and falls back to unauthenticated requests for public objects.
+// If STORAGE_EMULATOR_HOST is set, as with the official client libraries, requests go unauthenticated to that
+// host instead so a local stand-in such as fake-gcs-server can be used
+type GCSSource struct{}
+
+//Fetch gets the object at location
+func (src GCSSource) Fetch(ctx context.Context, location *url.URL) (*Document, error) {
+	return src.FetchIfChanged(ctx, location, nil)
+}
+
+//FetchIfChanged makes a conditional request for the object at location using the ETag and LastModified of prev
+func (GCSSource) FetchIfChanged(ctx context.Context, location *url.URL, prev *Document) (*Document, error) {
+	bucket, object := location.Host, strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("gs location must be of the form gs://bucket/object")
+	}
+	endpoint := "https://storage.googleapis.com"
+	client := newClient()
+	if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		endpoint = strings.TrimSuffix(emulator, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	} else if authed, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_only"); err == nil {
+		authed.Timeout = client.Timeout
+		client = authed
+	} else {
+		log.Printf("no GCP credentials found for config fetch - trying %s unauthenticated: %v", location, err)
+	}
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", endpoint, url.PathEscape(bucket), url.PathEscape(object))
+
+	return fetchHTTP(ctx, client, objectURL, location.String(), prev)
+}
+
+//fetchHTTP does the GET request to uri and returns the body as a Document labelled with location.
+//
+//If prev is given the request is conditional on its ETag and LastModified and a nil Document is returned if unchanged
+func fetchHTTP(ctx context.Context, client *http.Client, uri, location string, prev *Document) (*Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/yaml;q=0.9, text/yaml;q=0.9, */*;q=0.5")
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified && prev != nil {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response fetching config: %s", res.Status)
+	}
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		Location:     location,
+		Format:       detectFormat(path.Base(req.URL.Path), res.Header.Get("Content-Type"), raw),
+		Raw:          raw,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+//newClient returns the http client used to fetch remote configuration files
+func newClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 20 * time.Second,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		Timeout: 30 * time.Second,
+	}
+}
@@ -0,0 +1,114 @@
+package configuration
+
+import "fmt"
+
+//PageState is the state of a PollPage worked out from the verdicts of its recent pings
+type PageState string
+
+const (
+	StateUnknown  PageState = "UNKNOWN"  //StateUnknown is a page with no pings yet
+	StateUp       PageState = "UP"       //StateUp is a page passing its checks
+	StateDegraded PageState = "DEGRADED" //StateDegraded is a page failing checks but not yet enough of them to be down
+	StateDown     PageState = "DOWN"     //StateDown is a page that met the StatePolicy failure threshold
+)
+
+//StatePolicy sets how many failed pings it takes for a PollPage to be DOWN, how many passes to be UP again and when it is flapping.
+//
+//A page goes DOWN after ConsecutiveFailures failed pings in a row or, if Window is set,
+// after FailuresInWindow of the last Window pings failed. Any failure short of that makes an UP page DEGRADED
+type StatePolicy struct {
+	//ConsecutiveFailures is the failed pings in a row that make the page DOWN. Defaults to 3
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	//FailuresInWindow is the failed pings within the last Window pings that make the page DOWN. Needs Window
+	FailuresInWindow int `json:"failures_in_window,omitempty"`
+	//Window is the number of most recent pings looked at for FailuresInWindow and flapping. Defaults to 10
+	Window int `json:"window,omitempty"`
+	//RecoverySuccesses is the passed pings in a row that make a DEGRADED or DOWN page UP. Defaults to 1
+	RecoverySuccesses int `json:"recovery_successes,omitempty"`
+	//FlapChanges is the number of changes between pass and fail within the last Window pings that mark the page as flapping.
+	// Defaults to half the Window. State changes are not sent while a page flaps
+	FlapChanges int `json:"flap_changes,omitempty"`
+}
+
+//WithDefaults returns the StatePolicy with defaults in place of unset values
+func (policy StatePolicy) WithDefaults() StatePolicy {
+	if policy.ConsecutiveFailures <= 0 {
+		policy.ConsecutiveFailures = 3
+	}
+	if policy.Window <= 0 {
+		policy.Window = 10
+	}
+	if policy.RecoverySuccesses <= 0 {
+		policy.RecoverySuccesses = 1
+	}
+	if policy.FlapChanges <= 0 {
+		policy.FlapChanges = policy.Window / 2
+	}
+	return policy
+}
+
+//Validate returns every problem with the StatePolicy
+func (policy *StatePolicy) Validate() []error {
+	out := make([]error, 0)
+	if policy == nil {
+		return out
+	}
+	if policy.ConsecutiveFailures < 0 || policy.FailuresInWindow < 0 || policy.Window < 0 || policy.RecoverySuccesses < 0 || policy.FlapChanges < 0 {
+		out = append(out, fmt.Errorf("state thresholds must be positive"))
+	}
+	if policy.FailuresInWindow > 0 && policy.FailuresInWindow > policy.WithDefaults().Window {
+		out = append(out, fmt.Errorf("state failures_in_window of %d cannot be more than the window of %d", policy.FailuresInWindow, policy.WithDefaults().Window))
+	}
+	return out
+}
+
+//StateChange is the event sent when a PollPage moves between PageStates or starts or stops flapping
+type StateChange struct {
+	ServiceName string    `json:"service_name"`
+	CheckID     string    `json:"check_id"`
+	URL         string    `json:"url"`
+	From        PageState `json:"from"`
+	To          PageState `json:"to"`
+	//Flapping is whether the page is flapping. A change of Flapping with no change of state is sent when flapping starts or stops
+	Flapping bool   `json:"flapping"`
+	Time     string `json:"time"` //Time is when the change happened in RFC3339 format
+	//OutageStart is the time of the first failed ping of the outage in RFC3339 format. Set while the page is not UP and on recovery
+	OutageStart string `json:"outage_start,omitempty"`
+	//OutageSeconds is how long the outage has lasted, or lasted in total on recovery to UP
+	OutageSeconds int64 `json:"outage_duration_seconds,omitempty"`
+	//Reason is the error or failed assertions of the ping that caused the change
+	Reason string `json:"reason,omitempty"`
+}
+
+//ToTransport for StateChange to implement Transports
+func (change StateChange) ToTransport(conf Config) (Transporter, error) {
+	return Transporter{
+		EventType:                EventStateChange,
+		DisplayServiceName:       conf.ServiceName,
+		DisplayDomain:            conf.DisplayDomain,
+		Message:                  change.String(),
+		MessagePublishedDateTime: change.Time,
+		StateChange:              &change,
+		MetaStatusPage:           conf.StatusPage,
+	}, nil
+}
+
+//Send for StateChange to implement Transports
+func (change StateChange) Send(conf Config, sender chan<- Transporter) error {
+	transport, err := change.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
+
+func (change StateChange) String() string {
+	if change.From == change.To {
+		if change.Flapping {
+			return fmt.Sprintf("%s (%s) started flapping while %s", change.ServiceName, change.URL, change.To)
+		}
+		return fmt.Sprintf("%s (%s) stopped flapping and is %s", change.ServiceName, change.URL, change.To)
+	}
+	return fmt.Sprintf("%s (%s) changed from %s to %s", change.ServiceName, change.URL, change.From, change.To)
+}
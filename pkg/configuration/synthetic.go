@@ -0,0 +1,164 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/karlsburg87/statusSentry/pkg/jsonpath"
+)
+
+//CheckSynthetic is a synthetic:// page, such as synthetic://login, that runs its Steps in order as one transaction
+const CheckSynthetic CheckType = "synthetic"
+
+//maxSteps is the most steps a synthetic check may have
+const maxSteps = 20
+
+//stepVariable matches a {{name}} reference to a value extracted by an earlier Step
+var stepVariable = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+//Step is a single HTTP request of a synthetic check. Every step shares a cookie jar with the steps before it
+// and may use the values they extracted as {{name}} in its URL, headers and body
+type Step struct {
+	//Name identifies the step in the StepResult. Defaults to the step number
+	Name string `json:"name,omitempty"`
+	//URL is the http or https page to request
+	URL string `json:"url"`
+	//Method is the HTTP method of the step. Defaults to GET
+	Method string `json:"method,omitempty"`
+	//Headers are extra request headers sent with the step
+	Headers map[string]string `json:"headers,omitempty"`
+	//Body is the request body sent with the step
+	Body string `json:"body,omitempty"`
+	//ExpectedStatus are the status codes that count as success. Defaults to any 2xx or 3xx status code
+	ExpectedStatus []int `json:"expected_status,omitempty"`
+	//Assertions are further rules the response of the step must meet to pass
+	Assertions *Assertions `json:"assertions,omitempty"`
+	//Extract are values taken from the response for use by later steps
+	Extract []Extraction `json:"extract,omitempty"`
+}
+
+//Extraction names a value taken from the response body of a Step by a JSONPath expression or the first capture group of a regular expression
+type Extraction struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"json_path,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+}
+
+//StepResult is the result of a single Step of a synthetic check in PingResponse.Steps
+type StepResult struct {
+	Name             string        `json:"name"`
+	URL              string        `json:"url"`
+	Method           string        `json:"method"`
+	Passed           bool          `json:"passed"`
+	StatusCode       int           `json:"status_code,omitempty"`
+	ErrorText        string        `json:"error,omitempty"`
+	ErrorCategory    ErrorCategory `json:"error_category,omitempty"`
+	FailedAssertions []string      `json:"failed_assertions,omitempty"`
+	ResponseTimes    PingTimes     `json:"response_times"`
+	Extracted        []string      `json:"extracted,omitempty"` //Extracted are the names of the values taken from the response. Values are left out as they may be secret
+}
+
+//StepName returns the Name of the step, or its number from 1 at index i if it has none
+func (step Step) StepName(i int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+//Expand returns the step with each {{name}} in its URL, headers and body replaced by the value of name in values.
+// Fails on a name with no value
+func (step Step) Expand(values map[string]string) (Step, error) {
+	var missing []string
+	expand := func(s string) string {
+		return stepVariable.ReplaceAllStringFunc(s, func(ref string) string {
+			name := stepVariable.FindStringSubmatch(ref)[1]
+			value, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+	}
+	out := step
+	out.URL, out.Body = expand(step.URL), expand(step.Body)
+	if len(step.Headers) > 0 {
+		out.Headers = make(map[string]string, len(step.Headers))
+		for name, value := range step.Headers {
+			out.Headers[name] = expand(value)
+		}
+	}
+	if len(missing) > 0 {
+		return out, fmt.Errorf("no value extracted for %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+//Page returns the step as a PollPage to request and assert on like any other page
+func (step Step) Page() PollPage {
+	return PollPage{
+		URL:            step.URL,
+		Method:         step.Method,
+		Headers:        step.Headers,
+		Body:           step.Body,
+		ExpectedStatus: step.ExpectedStatus,
+		Assertions:     step.Assertions,
+	}
+}
+
+//validateSteps checks the Steps of a CheckSynthetic page, including that each {{name}} is extracted by an earlier step
+func validateSteps(page PollPage) []error {
+	out := make([]error, 0)
+	if len(page.Steps) == 0 || len(page.Steps) > maxSteps {
+		return append(out, fmt.Errorf("synthetic check %q must have between 1 and %d steps", page.URL, maxSteps))
+	}
+	extracted := make(map[string]bool)
+	for i, step := range page.Steps {
+		name := step.StepName(i)
+		if step.Page().CheckType() != CheckHTTP {
+			out = append(out, fmt.Errorf("%s: URL %q must be http or https", name, step.URL))
+			continue
+		}
+		for _, err := range validatePollPage(step.Page()) {
+			out = append(out, fmt.Errorf("%s: %v", name, err))
+		}
+		refs := []string{step.URL, step.Body}
+		for _, value := range step.Headers {
+			refs = append(refs, value)
+		}
+		for _, ref := range refs {
+			for _, match := range stepVariable.FindAllStringSubmatch(ref, -1) {
+				if !extracted[match[1]] {
+					out = append(out, fmt.Errorf("%s: {{%s}} is not extracted by an earlier step", name, match[1]))
+				}
+			}
+		}
+		for _, extract := range step.Extract {
+			if err := extract.validate(); err != nil {
+				out = append(out, fmt.Errorf("%s: %v", name, err))
+			}
+			extracted[extract.Name] = true
+		}
+	}
+	return out
+}
+
+//validate checks the Extraction has a name and exactly one valid expression
+func (extract Extraction) validate() error {
+	switch {
+	case !stepVariable.MatchString("{{" + extract.Name + "}}"):
+		return fmt.Errorf("extract name %q must be letters, digits and underscores", extract.Name)
+	case (extract.JSONPath == "") == (extract.Regex == ""):
+		return fmt.Errorf("extract %s must have one of json_path or regex", extract.Name)
+	case extract.JSONPath != "":
+		if _, err := jsonpath.Parse(extract.JSONPath); err != nil {
+			return fmt.Errorf("extract %s: %v", extract.Name, err)
+		}
+	default:
+		if _, err := regexp.Compile(extract.Regex); err != nil {
+			return fmt.Errorf("extract %s regex does not compile: %v", extract.Name, err)
+		}
+	}
+	return nil
+}
@@ -4,8 +4,23 @@ import (
 	"encoding/json"
 )
 
+//EventType is the kind of message a Transporter carries
+type EventType string
+
+const (
+	EventStatusUpdate  EventType = "status_update"  //EventStatusUpdate is an update from a status page
+	EventPing          EventType = "ping"           //EventPing is a PingResponse
+	EventStateChange   EventType = "state_change"   //EventStateChange is a PollPage moving between PageStates. See StateChange
+	EventCertExpiry    EventType = "cert_expiry"    //EventCertExpiry is a TLS certificate nearing expiry. See CertExpiry
+	EventDomainExpiry  EventType = "domain_expiry"  //EventDomainExpiry is a domain registration nearing expiry. See DomainExpiry
+	EventContentChange EventType = "content_change" //EventContentChange is a change of the watched content of a PollPage. See ContentChange
+)
+
 //Transporter is the standard transport struct used by all system senders and receivers
 type Transporter struct {
+	//EventType is the kind of message. Empty is read as a status update unless PingResponse is set. See Type
+	EventType EventType `json:"event_type,omitempty"`
+
 	//StausPage updates--------------------
 
 	//DisplayServiceName is the given name of the service as to display to end users. From Config
@@ -24,12 +39,34 @@ type Transporter struct {
 	//PingResponse is embedded object used to report on responses from ping checks
 	*PingResponse `json:",omitempty"`
 
+	//StateChange reports a PollPage moving between PageStates
+	StateChange *StateChange `json:"state_change,omitempty"`
+	//CertExpiry reports a TLS certificate of a PollPage crossing one of the Config.CertExpiryDays
+	CertExpiry *CertExpiry `json:"cert_expiry,omitempty"`
+	//DomainExpiry reports the registration of a domain of a Config crossing one of the Config.DomainExpiryDays
+	DomainExpiry *DomainExpiry `json:"domain_expiry,omitempty"`
+	//ContentChange reports a change of the watched content of a PollPage
+	ContentChange *ContentChange `json:"content_change,omitempty"`
+	//Incident is the structured incident of a status update from a status page API
+	Incident *Incident `json:"incident,omitempty"`
+
 	//Meta---------------------------------
 
 	//MetaStatusPage is the URL of the status page - different from the source of the updates used by the application
 	MetaStatusPage string `json:"status_page,omitempty"`
 }
 
+//Type returns the EventType of the transporter
+func (transporter Transporter) Type() EventType {
+	switch {
+	case transporter.EventType != "":
+		return transporter.EventType
+	case transporter.PingResponse != nil:
+		return EventPing
+	}
+	return EventStatusUpdate
+}
+
 //ToJSON returns a JSON representation of the transporter object
 func (transporter Transporter) ToJSON() ([]byte, error) {
 	return json.Marshal(transporter)
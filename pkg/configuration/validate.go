@@ -0,0 +1,305 @@
+package configuration
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//FieldError is a single problem found with a Config entry of a Configuration
+type FieldError struct {
+	Index       int    `json:"index"`        //Index is the position of the offending entry in the Configuration
+	ServiceName string `json:"service_name"` //ServiceName is the ServiceName of the offending entry, if any
+	Field       string `json:"field"`        //Field is the JSON name of the offending field
+	Message     string `json:"message"`      //Message describes what is wrong with the field
+}
+
+func (fe FieldError) Error() string {
+	return fmt.Sprintf("config[%d] (%q) %s: %s", fe.Index, fe.ServiceName, fe.Field, fe.Message)
+}
+
+//ValidationError is the structured report of every problem found by Configuration.Validate
+type ValidationError struct {
+	Problems []FieldError `json:"problems"`
+}
+
+func (ve *ValidationError) Error() string {
+	lines := make([]string, 0, len(ve.Problems))
+	for _, problem := range ve.Problems {
+		lines = append(lines, problem.Error())
+	}
+	return fmt.Sprintf("invalid configuration with %d problem(s):\n%s", len(ve.Problems), strings.Join(lines, "\n"))
+}
+
+//add records a problem against the entry at index i
+func (ve *ValidationError) add(i int, config Config, field, format string, args ...interface{}) {
+	ve.Problems = append(ve.Problems, FieldError{
+		Index:       i,
+		ServiceName: config.ServiceName,
+		Field:       field,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+//IsKnown reports whether the ServiceType is one the application can process
+func (serviceType ServiceType) IsKnown() bool {
+	switch serviceType {
+	case ServiceWebhook, ServiceRSS, ServiceEmail, ServiceTwitter, ServiceStatuspage:
+		return true
+	}
+	return false
+}
+
+//Validate checks every entry of the Configuration and returns a *ValidationError listing all problems found
+// with their entry index and field, or nil if the Configuration is usable
+func (configuration Configuration) Validate() error {
+	report := &ValidationError{}
+	names := make(map[string]int)       //normalised ServiceName against the index it was first seen at
+	checkIDs := make(map[string]string) //PollPage.ID against where it was first seen
+	hookPaths := make(map[string]int)   //custom webhook path against the index it was first seen at
+
+	//custom paths are matched before /webhook/${ServiceName} so a path taking that route leaves the named service unroutable
+	customRoutes := make(map[string]int) //lower cased custom webhook path against the index it was first seen at
+	namedRoutes := make(map[string]int)  //lower cased /webhook/${ServiceName} route against the index it was first seen at
+	for i, config := range configuration {
+		if serviceType, _ := config.ParseServiceInfo(); serviceType != ServiceWebhook {
+			continue
+		}
+		if _, path := config.WebhookSource(); path != "" {
+			route := strings.ToLower(strings.TrimSuffix(path, "/"))
+			if _, ok := customRoutes[route]; !ok {
+				customRoutes[route] = i
+			}
+		}
+		if name := strings.ToLower(strings.TrimSpace(config.ServiceName)); name != "" {
+			if _, ok := namedRoutes["/webhook/"+name]; !ok {
+				namedRoutes["/webhook/"+name] = i
+			}
+		}
+	}
+
+	for i, config := range configuration {
+		//ServiceName
+		name := strings.ToLower(strings.TrimSpace(config.ServiceName))
+		if name == "" {
+			report.add(i, config, "service_name", "is mandatory")
+		} else if first, ok := names[name]; ok {
+			report.add(i, config, "service_name", "duplicates the service name of config[%d]", first)
+		} else {
+			names[name] = i
+		}
+		if serviceType, _ := config.ParseServiceInfo(); serviceType == ServiceWebhook && name != "" {
+			if owner, ok := customRoutes["/webhook/"+name]; ok && owner != i {
+				report.add(i, config, "service_name", "webhook updates to /webhook/%s are taken by the webhook path of config[%d]", strings.TrimSpace(config.ServiceName), owner)
+			}
+		}
+
+		if config.TargetHook == "" && len(config.PollPages) == 0 {
+			report.add(i, config, "status_source", "one of status_source or poll_pages is mandatory")
+		}
+
+		//TargetHook
+		if config.TargetHook != "" {
+			validateTargetHook(report, i, config)
+		}
+		if serviceType, _ := config.ParseServiceInfo(); serviceType == ServiceWebhook {
+			if _, path := config.WebhookSource(); path != "" {
+				path = strings.TrimSuffix(path, "/")
+				if first, ok := hookPaths[path]; ok {
+					report.add(i, config, "status_source", "webhook path duplicates the path of config[%d]", first)
+				} else {
+					hookPaths[path] = i
+				}
+				if named, ok := namedRoutes[strings.ToLower(path)]; ok && named != i {
+					report.add(i, config, "status_source", "webhook path %q takes the /webhook/ route of config[%d]", path, named)
+				}
+			}
+		}
+
+		//InboundAuth
+		if config.InboundAuth != nil {
+			if serviceType, _ := config.ParseServiceInfo(); serviceType != ServiceWebhook && serviceType != ServiceEmail {
+				report.add(i, config, "inbound_auth", "is only checked for webhook and email status sources")
+			}
+			for _, err := range config.InboundAuth.Validate() {
+				report.add(i, config, "inbound_auth", "%v", err)
+			}
+		}
+
+		//PollFrequency
+		if config.PollFrequency < 0 {
+			report.add(i, config, "poll_frequency", "must be positive")
+		} else if config.PollFrequency == 0 && needsPollFrequency(config.PollPages) {
+			report.add(i, config, "poll_frequency", "is mandatory and must be positive when poll_pages without their own frequency are given")
+		}
+
+		//SLOTarget
+		if config.SLOTarget < 0 || config.SLOTarget > 100 {
+			report.add(i, config, "slo_target", "must be a percentage between 0 and 100 e.g. 99.9")
+		}
+
+		//CertExpiryDays and DomainExpiryDays
+		for _, thresholds := range []struct {
+			field string
+			days  []int
+		}{{"cert_expiry_days", config.CertExpiryDays}, {"domain_expiry_days", config.DomainExpiryDays}} {
+			for _, days := range thresholds.days {
+				if days <= 0 {
+					report.add(i, config, thresholds.field, "must all be positive, got %d", days)
+					break
+				}
+			}
+		}
+
+		//PollPages
+		pageKeys := make(map[string]int) //PollPage.Key against the index it was first seen at
+		for j, page := range config.PollPages {
+			field := fmt.Sprintf("poll_pages[%d]", j)
+			for _, err := range validatePollPage(page) {
+				report.add(i, config, field, "%v", err)
+			}
+			if first, ok := pageKeys[page.Key()]; ok {
+				report.add(i, config, field, "duplicates poll_pages[%d] - give each check of the same URL a unique id", first)
+			} else {
+				pageKeys[page.Key()] = j
+			}
+			if page.ID != "" {
+				if first, ok := checkIDs[page.ID]; ok {
+					report.add(i, config, field+".id", "duplicates the check id of %s", first)
+				} else {
+					checkIDs[page.ID] = fmt.Sprintf("config[%d].%s", i, field)
+				}
+			}
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		return report
+	}
+	return nil
+}
+
+//validateTargetHook checks the service type prefix and the hook that follows it
+func validateTargetHook(report *ValidationError, i int, config Config) {
+	if !strings.Contains(config.TargetHook, ":") {
+		report.add(i, config, "status_source", "must be prefixed with a service type e.g. rss:https://example.com/feed")
+		return
+	}
+	serviceType, hook := config.ParseServiceInfo()
+	if !serviceType.IsKnown() {
+		report.add(i, config, "status_source", "unknown service type %q", serviceType)
+		return
+	}
+	switch serviceType {
+	case ServiceRSS, ServiceStatuspage:
+		if err := validateHTTPURL(hook); err != nil {
+			report.add(i, config, "status_source", "%v", err)
+		}
+	case ServiceTwitter:
+		if strings.TrimSpace(strings.TrimPrefix(hook, "@")) == "" {
+			report.add(i, config, "status_source", "twitter handle or id is missing")
+		}
+	case ServiceEmail:
+		if !strings.Contains(hook, "@") {
+			report.add(i, config, "status_source", "%q is not an email address", hook)
+		}
+	case ServiceWebhook:
+		//updates arrive at /webhook/${ServiceName} with any '/', '?' or '#' of the name URL encoded so every name can be routed
+		format, path := config.WebhookSource()
+		if !format.IsKnown() {
+			report.add(i, config, "status_source", "unknown webhook format %q, must be one of statuspage, incidentio or instatus", format)
+		}
+		if strings.ContainsAny(path, "?# ") {
+			report.add(i, config, "status_source", "webhook path %q must not contain a query, fragment or spaces", path)
+		}
+		//the root and /email are served by the webhook server itself
+		if trimmed := strings.TrimSuffix(path, "/"); path != "" && (trimmed == "" || trimmed == "/email") {
+			report.add(i, config, "status_source", "webhook path %q is reserved", path)
+		}
+	}
+}
+
+//needsPollFrequency reports whether any of pages relies on the Config.PollFrequency
+func needsPollFrequency(pages []PollPage) bool {
+	for _, page := range pages {
+		if page.Frequency == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//maxRetries is the most retries a PollPage may have so a dead page cannot hold up a poll worker for long
+const maxRetries = 10
+
+//validatePollPage checks a PollPages entry is an absolute http(s) URL with a usable check definition
+func validatePollPage(page PollPage) []error {
+	out := make([]error, 0)
+	if err := validateCheckURL(page); err != nil {
+		out = append(out, err)
+	}
+	if page.Method != "" && !isHTTPToken(page.Method) {
+		out = append(out, fmt.Errorf("method %q is not a valid HTTP method", page.Method))
+	}
+	for name := range page.Headers {
+		if !isHTTPToken(name) {
+			out = append(out, fmt.Errorf("header name %q is not valid", name))
+		}
+	}
+	for _, code := range page.ExpectedStatus {
+		if code < 100 || code > 599 {
+			out = append(out, fmt.Errorf("expected status %d is not an HTTP status code", code))
+		}
+	}
+	if page.Timeout < 0 {
+		out = append(out, fmt.Errorf("timeout must be positive"))
+	}
+	if page.Frequency < 0 {
+		out = append(out, fmt.Errorf("frequency must be positive"))
+	}
+	if page.Retries < 0 || page.Retries > maxRetries {
+		out = append(out, fmt.Errorf("retries must be between 0 and %d", maxRetries))
+	}
+	if page.RetryDelay < 0 {
+		out = append(out, fmt.Errorf("retry_delay must be positive"))
+	}
+	out = append(out, page.Assertions.Validate()...)
+	out = append(out, page.State.Validate()...)
+	out = append(out, page.Content.Validate()...)
+	if page.CheckType() == CheckSynthetic {
+		out = append(out, validateSteps(page)...)
+	}
+	if page.Auth != nil && page.CheckType() != CheckHTTP && page.CheckType() != CheckSynthetic {
+		out = append(out, fmt.Errorf("auth is only sent by http, https and synthetic checks"))
+	}
+	out = append(out, page.Auth.Validate()...)
+	return out
+}
+
+//isHTTPToken reports whether s is a valid HTTP token as used for methods and header names
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r > 127 || r <= ' ' || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+//validateHTTPURL checks raw is an absolute http or https URL
+func validateHTTPURL(raw string) error {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("malformed URL %q: %v", raw, err)
+	}
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("URL %q must use the http or https scheme", raw)
+	}
+	if uri.Host == "" {
+		return fmt.Errorf("URL %q has no host", raw)
+	}
+	return nil
+}
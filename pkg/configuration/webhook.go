@@ -0,0 +1,37 @@
+package configuration
+
+import (
+	"strings"
+)
+
+//WebhookFormat is the payload format of a webhook status source, read from its TargetHook
+type WebhookFormat string
+
+const (
+	WebhookRaw        WebhookFormat = ""           //WebhookRaw payloads are sent on as received
+	WebhookStatuspage WebhookFormat = "statuspage" //WebhookStatuspage is an Atlassian Statuspage subscriber webhook
+	WebhookIncidentIO WebhookFormat = "incidentio" //WebhookIncidentIO is an incident.io status page webhook
+	WebhookInstatus   WebhookFormat = "instatus"   //WebhookInstatus is an Instatus subscriber webhook
+)
+
+//IsKnown reports whether the WebhookFormat is one the application can decode
+func (format WebhookFormat) IsKnown() bool {
+	switch format {
+	case WebhookRaw, WebhookStatuspage, WebhookIncidentIO, WebhookInstatus:
+		return true
+	}
+	return false
+}
+
+//WebhookSource splits the hook of a webhook TargetHook into its payload format and path.
+//
+//The hook is an optional format followed by an optional path e.g. webhook:statuspage, webhook:/endpoint/path
+// or webhook:incidentio/endpoint/path
+func (config *Config) WebhookSource() (format WebhookFormat, path string) {
+	_, hook := config.ParseServiceInfo()
+	hook = strings.TrimSpace(hook)
+	if i := strings.Index(hook, "/"); i >= 0 {
+		return WebhookFormat(strings.ToLower(hook[:i])), hook[i:]
+	}
+	return WebhookFormat(strings.ToLower(hook)), ""
+}
@@ -0,0 +1,36 @@
+package dispatch
+
+import (
+	"log"
+	"sync"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//Recorder keeps a copy of every Transporter handed to a Sender, such as the history store
+type Recorder interface {
+	Record(configuration.Transporter) error
+}
+
+var (
+	recordersMu sync.RWMutex
+	recorders   []Recorder
+)
+
+//AddRecorder registers a Recorder with every Sender. Register before launching the services so no Transporter is missed
+func AddRecorder(recorder Recorder) {
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	recorders = append(recorders, recorder)
+}
+
+//record hands t to every registered Recorder. Failures are logged so they never hold up sending
+func record(t configuration.Transporter) {
+	recordersMu.RLock()
+	defer recordersMu.RUnlock()
+	for _, recorder := range recorders {
+		if err := recorder.Record(t); err != nil {
+			log.Printf("error recording transport for %s: %v", t.DisplayServiceName, err)
+		}
+	}
+}
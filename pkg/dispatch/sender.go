@@ -90,6 +90,7 @@ func Sender(destinationURL string, senderFunnel <-chan configuration.Transporter
 		select {
 		case t := <-senderFunnel:
 			//---fmt.Printf("Outbound: %+v\n\n", t)
+			record(t)
 			if isGCP {
 				pubsub <- t
 			}
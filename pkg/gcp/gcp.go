@@ -22,6 +22,10 @@ func Publisher(stuff <-chan configuration.Transporter) {
 	if statusUpdateTopic == "" {
 		statusUpdateTopic = "statusUpdates"
 	}
+	eventTopic := os.Getenv("EVENT_TOPIC")
+	if eventTopic == "" {
+		eventTopic = "pageEvents"
+	}
 
 	ctx := context.Background()
 	client, err := pubsub.NewClient(ctx, projectID)
@@ -32,7 +36,7 @@ func Publisher(stuff <-chan configuration.Transporter) {
 	defer client.Close()
 
 	//create topics if not exist
-	var topic, statusT, pingT *pubsub.Topic
+	var topic, statusT, pingT, eventT *pubsub.Topic
 	if pingT, err = client.CreateTopic(ctx, pingTopic); err != nil {
 		//assume Topic exists so get
 		pingT = client.Topic(pingTopic)
@@ -43,13 +47,21 @@ func Publisher(stuff <-chan configuration.Transporter) {
 		//assume Topic exists so get
 		statusT = client.Topic(statusUpdateTopic)
 	}
-	log.Printf("GCP PubSub goroutine ready to receive using topics %s and %s", pingTopic, statusUpdateTopic)
+	if eventT, err = client.CreateTopic(ctx, eventTopic); err != nil {
+		//assume Topic exists so get
+		eventT = client.Topic(eventTopic)
+	}
+	log.Printf("GCP PubSub goroutine ready to receive using topics %s, %s and %s", pingTopic, statusUpdateTopic, eventTopic)
 	for msg := range stuff {
 		//different topics for ping and status page updates
 		// Hardcoded by design
-		topic = statusT
-		if msg.PingResponse != nil {
+		switch msg.Type() {
+		case configuration.EventPing:
 			topic = pingT
+		case configuration.EventStateChange, configuration.EventCertExpiry, configuration.EventDomainExpiry, configuration.EventContentChange:
+			topic = eventT
+		default:
+			topic = statusT
 		}
 		payload, err := msg.ToJSON()
 		if err != nil {
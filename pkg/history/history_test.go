@@ -0,0 +1,249 @@
+package history
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+func TestStoreRecordsQueriesAndCompacts(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), Retention{Raw: 24 * time.Hour, Hourly: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Date(2022, 3, 10, 12, 30, 0, 0, time.UTC)
+	pings := []configuration.PingResponse{
+		{ServiceName: "Stripe", CheckID: "www", URL: "https://www.stripe.com", Passed: true, ResponseTimes: configuration.PingTimes{Total: 40}, TimeGo: now.Add(-48 * time.Hour)},
+		{ServiceName: "Stripe", CheckID: "www", URL: "https://www.stripe.com", Passed: true, ResponseTimes: configuration.PingTimes{Total: 80}, TimeGo: now.Add(-20 * time.Minute)},
+		{ServiceName: "Stripe", CheckID: "www", URL: "https://www.stripe.com", Passed: false, ResponseTimes: configuration.PingTimes{Total: 3000}, TimeGo: now.Add(-10 * time.Minute)},
+		{ServiceName: "Stripe", CheckID: "api", URL: "https://api.stripe.com", Passed: true, ResponseTimes: configuration.PingTimes{Total: 20}, TimeGo: now.Add(-10 * time.Minute)},
+		{ServiceName: "Paypal", CheckID: "www", URL: "https://www.paypal.com", Passed: true, ResponseTimes: configuration.PingTimes{Total: 20}, TimeGo: now.Add(-5 * time.Minute)},
+	}
+	for _, ping := range pings {
+		if err := store.Record(configuration.Transporter{PingResponse: &ping}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update := configuration.Transporter{DisplayServiceName: "Stripe", Message: "Degraded API", MessagePublishedDateTime: now.Add(-15 * time.Minute).Format(time.RFC3339)}
+	if err := store.Record(update); err != nil {
+		t.Fatal(err)
+	}
+	store.Flush()
+
+	got, err := store.Pings(Query{ServiceName: "Stripe", From: now.Add(-time.Hour), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].ResponseTimes.Total != 80 || got[0].ServiceName != "Stripe" || !got[0].TimeGo.Equal(now.Add(-20*time.Minute)) {
+		t.Errorf("unexpected service pings %+v", got)
+	}
+	if got, _ := store.Pings(Query{ServiceName: "Stripe", CheckID: "api"}); len(got) != 1 {
+		t.Errorf("expected a single api ping, got %d", len(got))
+	}
+	if got, _ := store.Pings(Query{}); len(got) != len(pings) {
+		t.Errorf("expected every ping, got %d", len(got))
+	}
+	updates, err := store.StatusUpdates(Query{ServiceName: "Stripe"})
+	if err != nil || len(updates) != 1 || updates[0].Message != "Degraded API" {
+		t.Errorf("unexpected updates %+v %v", updates, err)
+	}
+
+	hourly, err := store.Rollups(Query{ServiceName: "Stripe", CheckID: "www", From: now.Add(-time.Hour)}, Hourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 1 || hourly[0].Count != 2 || hourly[0].Passed != 1 || hourly[0].MinMs != 80 || hourly[0].MaxMs != 3000 || hourly[0].Uptime() != 0.5 {
+		t.Errorf("unexpected hourly rollups %+v", hourly)
+	}
+	if daily, _ := store.Rollups(Query{ServiceName: "Stripe"}, Daily); len(daily) != 3 {
+		t.Errorf("expected a daily rollup for each page and day, got %+v", daily)
+	}
+
+	//the raw ping from two days ago goes but its rollups stay within their retention
+	if err := store.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Pings(Query{ServiceName: "Stripe", CheckID: "www"}); len(got) != 2 {
+		t.Errorf("expected the old raw ping to be compacted, got %d", len(got))
+	}
+	if hourly, _ := store.Rollups(Query{ServiceName: "Stripe", CheckID: "www"}, Hourly); len(hourly) != 2 {
+		t.Errorf("expected hourly rollups to be kept, got %d", len(hourly))
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	ping := func(url string, minute int, passed bool, total int64) configuration.PingResponse {
+		return configuration.PingResponse{ServiceName: "Stripe", URL: url, TimeGo: at(minute), Passed: passed, ResponseTimes: configuration.PingTimes{Total: total}}
+	}
+	//www is down from minute 10 to 20 and api from 15 to 30 with a final outage from 50 to the end at 60
+	pings := []configuration.PingResponse{
+		ping("www", 0, true, 100), ping("api", 0, true, 50),
+		ping("www", 10, false, 900), ping("api", 15, false, 700),
+		ping("www", 20, true, 110), ping("api", 30, true, 60),
+		ping("www", 40, true, 120), ping("www", 50, false, 1000),
+		ping("www", 70, true, 100), //outside the window
+	}
+	report := Calculate(pings, at(0), at(60))
+	if report.CoveragePercent != 100 || report.ObservedMinutes != 60 {
+		t.Errorf("expected the whole window to be covered, got %+v", report)
+	}
+	if late := Calculate(pings, at(-60), at(60)); late.CoveragePercent != 50 || late.UptimePercent != 50 {
+		t.Errorf("expected half the window to be covered, got %+v", late)
+	}
+	if report.Checks != 8 || report.Outages != 2 || report.DowntimeMinutes != 30 || report.MTTRMinutes != 20 || report.MTBFMinutes != 15 {
+		t.Errorf("unexpected service report %+v", report)
+	}
+	if report.UptimePercent != 50 || report.LatencyP50 != 110 || report.LatencyP95 != 1000 || report.LatencyP99 != 1000 {
+		t.Errorf("unexpected service uptime and latency %+v", report)
+	}
+
+	www := make([]configuration.PingResponse, 0)
+	for _, p := range pings {
+		if p.URL == "www" {
+			www = append(www, p)
+		}
+	}
+	page := Calculate(www, at(0), at(60))
+	if page.Outages != 2 || page.DowntimeMinutes != 20 || page.MTTRMinutes != 10 {
+		t.Errorf("unexpected page report %+v", page)
+	}
+
+	page.withTarget(99.9)
+	if page.SLOMet == nil || *page.SLOMet {
+		t.Errorf("expected the SLO to be missed %+v", page)
+	}
+}
+
+func TestSLABeyondRawRetention(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), Retention{Raw: 24 * time.Hour, Hourly: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	from := day.Add(-72 * time.Hour)
+	//down for two hours when only daily rollups are left, for an hour when hourly rollups are left and for 20 minutes of raw pings
+	outages := [][2]time.Time{
+		{day.Add(-60 * time.Hour), day.Add(-58 * time.Hour)},
+		{day.Add(-24 * time.Hour), day.Add(-23 * time.Hour)},
+		{now.Add(-40 * time.Minute), now.Add(-20 * time.Minute)},
+	}
+	checks := 0
+	for at := from; at.Before(now); at = at.Add(10 * time.Minute) {
+		ping := configuration.PingResponse{ServiceName: "Stripe", URL: "https://www.stripe.com", TimeGo: at, Passed: true, ResponseTimes: configuration.PingTimes{Total: 100}}
+		for _, outage := range outages {
+			if !at.Before(outage[0]) && at.Before(outage[1]) {
+				ping.Passed, ping.ResponseTimes.Total = false, 0
+			}
+		}
+		if err := store.RecordPing(ping); err != nil {
+			t.Fatal(err)
+		}
+		checks++
+	}
+	if err := store.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := store.SLA("Stripe", from, now, 99.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RollupsUntil.IsZero() || !report.RollupsUntil.After(from) {
+		t.Errorf("expected the start of the window to come from rollups, got %v", report.RollupsUntil)
+	}
+	if report.Checks != checks || report.Outages != 3 || math.Abs(report.DowntimeMinutes-200) > 0.01 || report.LatencyP50 != 100 {
+		t.Errorf("expected %d checks and 3 outages down for 200 minutes, got %+v", checks, report)
+	}
+	if math.Abs(report.CoveragePercent-100) > 0.01 || len(report.Pages) != 1 || report.Pages[0].Outages != 3 {
+		t.Errorf("expected the whole window to be covered, got %+v", report)
+	}
+
+	//time before the first ping is not covered
+	report, err = store.SLA("Stripe", from.Add(-72*time.Hour), now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(now.Sub(from)) / float64(now.Sub(from.Add(-72*time.Hour))) * 100; math.Abs(report.CoveragePercent-want) > 0.01 {
+		t.Errorf("expected %v%% of the window to be covered, got %v", want, report.CoveragePercent)
+	}
+}
+
+func TestRecordQueuesUntilClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(path, DefaultRetention())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		ping := configuration.PingResponse{ServiceName: "Stripe", URL: "https://www.stripe.com", Passed: true, TimeGo: now.Add(time.Duration(-i) * time.Second)}
+		if err := store.Record(configuration.Transporter{PingResponse: &ping}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//Close must write everything still queued
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Record(configuration.Transporter{DisplayServiceName: "Stripe"}); err == nil {
+		t.Error("expected an error recording to a closed store")
+	}
+
+	store, err = Open(path, DefaultRetention())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, err := store.Pings(Query{ServiceName: "Stripe"}); err != nil || len(got) != 50 {
+		t.Errorf("expected every queued ping written, got %d %v", len(got), err)
+	}
+}
+
+func TestSLAKeepsChecksOfOneURLApart(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), DefaultRetention())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	get := configuration.PollPage{URL: "https://www.stripe.com"}
+	head := configuration.PollPage{URL: "https://www.stripe.com", Method: "HEAD"}
+	for i := 0; i < 4; i++ {
+		for _, page := range []configuration.PollPage{get, head} {
+			//the HEAD check always fails
+			ping := configuration.PingResponse{ServiceName: "Stripe", CheckID: page.CheckID("Stripe"), URL: page.URL, Method: page.HTTPMethod(), Passed: page.Method == "", TimeGo: now.Add(time.Duration(i-4) * time.Minute)}
+			if err := store.RecordPing(ping); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got, _ := store.Pings(Query{ServiceName: "Stripe", CheckID: head.CheckID("Stripe")}); len(got) != 4 || got[0].Passed {
+		t.Errorf("expected only the HEAD check pings, got %+v", got)
+	}
+	report, err := store.SLA("Stripe", now.Add(-time.Hour), now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Pages) != 2 {
+		t.Fatalf("expected a page report per check, got %+v", report.Pages)
+	}
+	for _, page := range report.Pages {
+		want := 100.0
+		if page.CheckID == head.CheckID("Stripe") {
+			want = 0
+		}
+		if page.URL != "https://www.stripe.com" || page.Checks != 4 || page.UptimePercent != want {
+			t.Errorf("unexpected page report %+v", page)
+		}
+	}
+}
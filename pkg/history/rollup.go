@@ -0,0 +1,203 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	bolt "go.etcd.io/bbolt"
+)
+
+//Resolution is the period summarised by a Rollup
+type Resolution string
+
+const (
+	Hourly Resolution = "hourly"
+	Daily  Resolution = "daily"
+)
+
+//Duration returns the length of the Resolution period
+func (resolution Resolution) Duration() time.Duration {
+	if resolution == Daily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+//LatencyBounds are the inclusive upper bounds in milliseconds of each Rollup.Latency bucket.
+// The last bucket of Rollup.Latency counts everything slower
+var LatencyBounds = []int64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+//Rollup summarises the pings of a page check over an hour or day, starting at Start in UTC
+type Rollup struct {
+	ServiceName string     `json:"service_name"`
+	CheckID     string     `json:"check_id,omitempty"`
+	URL         string     `json:"url"`
+	Resolution  Resolution `json:"resolution"`
+	Start       time.Time  `json:"start"`
+	Count       int64      `json:"count"`    //Count is the number of pings
+	Passed      int64      `json:"passed"`   //Passed is the number of pings that passed
+	TotalMs     int64      `json:"total_ms"` //TotalMs is the sum of the ResponseTimes.Total of the pings
+	MinMs       int64      `json:"min_ms"`   //MinMs is the fastest ResponseTimes.Total
+	MaxMs       int64      `json:"max_ms"`   //MaxMs is the slowest ResponseTimes.Total
+	Latency     []int64    `json:"latency"`  //Latency is the count of pings in each of the LatencyBounds buckets plus one for slower pings
+}
+
+//Uptime returns the share of pings that passed from 0 to 1
+func (rollup Rollup) Uptime() float64 {
+	if rollup.Count == 0 {
+		return 0
+	}
+	return float64(rollup.Passed) / float64(rollup.Count)
+}
+
+//checkKey returns the key of the page check of the Rollup in the store. See checkKey
+func (rollup Rollup) checkKey() string {
+	if rollup.CheckID != "" {
+		return rollup.CheckID
+	}
+	return rollup.URL
+}
+
+//MeanMs returns the mean ResponseTimes.Total of the pings
+func (rollup Rollup) MeanMs() float64 {
+	if rollup.Count == 0 {
+		return 0
+	}
+	return float64(rollup.TotalMs) / float64(rollup.Count)
+}
+
+//add includes ping in the Rollup
+func (rollup *Rollup) add(ping configuration.PingResponse) {
+	total := ping.ResponseTimes.Total
+	if rollup.Count == 0 || total < rollup.MinMs {
+		rollup.MinMs = total
+	}
+	if total > rollup.MaxMs {
+		rollup.MaxMs = total
+	}
+	rollup.Count++
+	if ping.Passed {
+		rollup.Passed++
+	}
+	rollup.TotalMs += total
+	if len(rollup.Latency) != len(LatencyBounds)+1 {
+		rollup.Latency = make([]int64, len(LatencyBounds)+1)
+	}
+	rollup.Latency[sort.Search(len(LatencyBounds), func(i int) bool { return total <= LatencyBounds[i] })]++
+}
+
+//addToRollup adds ping to the Rollup of its page check for the period of resolution it falls in
+func addToRollup(tx *bolt.Tx, resolution Resolution, ping configuration.PingResponse) error {
+	bucket, err := nestedBucket(tx, []byte(resolution), ping.ServiceName, checkKey(ping))
+	if err != nil {
+		return err
+	}
+	start := ping.TimeGo.UTC().Truncate(resolution.Duration())
+	key := timeKey(start, 0)
+	rollup := Rollup{ServiceName: ping.ServiceName, CheckID: ping.CheckID, URL: ping.URL, Resolution: resolution, Start: start}
+	if raw := bucket.Get(key); raw != nil {
+		if err := json.Unmarshal(raw, &rollup); err != nil {
+			return err
+		}
+	}
+	rollup.add(ping)
+	raw, err := json.Marshal(rollup)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, raw)
+}
+
+//Rollups returns the Rollups of resolution matching query, oldest first. A Rollup is included if it starts within the query range
+func (store *Store) Rollups(query Query, resolution Resolution) ([]Rollup, error) {
+	out := make([]Rollup, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(resolution))
+		if root == nil {
+			return nil
+		}
+		return eachInRange(root, query, true, func(key, value []byte) error {
+			var rollup Rollup
+			if err := json.Unmarshal(value, &rollup); err != nil {
+				return err
+			}
+			out = append(out, rollup)
+			return nil
+		})
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, err
+}
+
+//Compact deletes the records of each level of history older than its Retention at now
+func (store *Store) Compact(now time.Time) error {
+	levels := []struct {
+		buckets   [][]byte
+		retention time.Duration
+	}{
+		{[][]byte{pingsBucket, updatesBucket}, store.retention.Raw},
+		{[][]byte{[]byte(Hourly)}, store.retention.Hourly},
+		{[][]byte{[]byte(Daily)}, store.retention.Daily},
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, level := range levels {
+			if level.retention <= 0 {
+				continue
+			}
+			cutoff := timeKey(now.Add(-level.retention), 0)
+			for _, name := range level.buckets {
+				if err := deleteBefore(tx.Bucket(name), cutoff); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//deleteBefore deletes every record keyed before cutoff in bucket and its nested buckets
+func deleteBefore(bucket *bolt.Bucket, cutoff []byte) error {
+	expired := make([][]byte, 0)
+	nested := make([][]byte, 0)
+	c := bucket.Cursor()
+	for key, value := c.First(); key != nil; key, value = c.Next() {
+		switch {
+		case value == nil:
+			nested = append(nested, append([]byte(nil), key...))
+		case string(key) < string(cutoff):
+			expired = append(expired, append([]byte(nil), key...))
+		}
+	}
+	//deleting while iterating a cursor skips records so delete after
+	for _, key := range expired {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, key := range nested {
+		if err := deleteBefore(bucket.Bucket(key), cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Run compacts the store every interval until ctx is done
+func (store *Store) Run(ctx context.Context, interval time.Duration) {
+	tckr := time.NewTicker(interval)
+	defer tckr.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tckr.C:
+			if err := store.Compact(now); err != nil {
+				log.Printf("error compacting history store: %v", err)
+			}
+		}
+	}
+}
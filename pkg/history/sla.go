@@ -0,0 +1,378 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//Report is the availability and latency of a service, or of one of its page checks, over the window From to To.
+//
+//Each ping verdict is taken to hold from the ping until the next ping of the same check, or To for the last.
+// A service is down while any of its pages is down. Time before the first ping of the window is not counted,
+// which CoveragePercent shows
+type Report struct {
+	ServiceName     string    `json:"service_name"`
+	CheckID         string    `json:"check_id,omitempty"` //CheckID is the page check of the Report. Empty for the service as a whole
+	URL             string    `json:"url,omitempty"`      //URL is the page of the checks of the Report. Empty for the service as a whole
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Checks          int       `json:"checks"`           //Checks is the number of pings in the window
+	UptimePercent   float64   `json:"uptime_percent"`   //UptimePercent is the share of the observed time that was up
+	DowntimeMinutes float64   `json:"downtime_minutes"` //DowntimeMinutes is the observed time that was down
+	Outages         int       `json:"outages"`          //Outages is the number of times the state went from up to down
+	MTTRMinutes     float64   `json:"mttr_minutes"`     //MTTRMinutes is the mean time to recover from the outages that ended in the window
+	MTBFMinutes     float64   `json:"mtbf_minutes"`     //MTBFMinutes is the mean up time between outages. Zero if there were none
+	LatencyP50      int64     `json:"latency_p50_ms"`   //LatencyP50 is the median ResponseTimes.Total
+	LatencyP95      int64     `json:"latency_p95_ms"`
+	LatencyP99      int64     `json:"latency_p99_ms"`
+	SLOTarget       float64   `json:"slo_target,omitempty"` //SLOTarget is the Config.SLOTarget of the service
+	SLOMet          *bool     `json:"slo_met,omitempty"`    //SLOMet is whether UptimePercent met the SLOTarget. Not set without a target
+	Pages           []Report  `json:"pages,omitempty"`      //Pages are the Reports of each page check of a service Report
+
+	//ObservedMinutes is the time of the window covered by pings
+	ObservedMinutes float64 `json:"observed_minutes"`
+	//CoveragePercent is the share of the window covered by pings. Below 100 when the window starts before the
+	// first ping or has stretches without any, such as history already past its retention
+	CoveragePercent float64 `json:"coverage_percent"`
+	//RollupsUntil is the end of the part of the window calculated from hourly and daily Rollups as raw pings
+	// that old are no longer kept. Zero when the whole window is calculated from raw pings
+	RollupsUntil time.Time `json:"rollups_until,omitempty"`
+}
+
+//span is a stretch of observed time that was either all up or all down
+type span struct {
+	start, end time.Time
+	down       bool
+}
+
+//latencySample is a response time in milliseconds seen count times
+type latencySample struct {
+	ms    int64
+	count int64
+}
+
+//Calculate returns the Report of pings between from and to, treating every page in pings as part of one service
+func Calculate(pings []configuration.PingResponse, from, to time.Time) Report {
+	return calculate(pings, nil, from, from, to)
+}
+
+//calculate returns the Report between from and to of rollups before rawFrom and of pings from rawFrom,
+// treating every page as part of one service
+func calculate(pings []configuration.PingResponse, rollups []Rollup, from, rawFrom, to time.Time) Report {
+	report := Report{From: from, To: to}
+	if rawFrom.After(from) {
+		report.RollupsUntil = rawFrom
+	}
+	inWindow := make([]configuration.PingResponse, 0, len(pings))
+	for _, ping := range pings {
+		if !ping.TimeGo.Before(rawFrom) && ping.TimeGo.Before(to) {
+			inWindow = append(inWindow, ping)
+		}
+	}
+	sort.SliceStable(inWindow, func(i, j int) bool { return inWindow[i].TimeGo.Before(inWindow[j].TimeGo) })
+
+	spans, samples, checks := rollupSpans(rollups, from, rawFrom)
+	spans = append(spans, pingSpans(inWindow, to)...)
+	for _, ping := range inWindow {
+		if ping.ResponseTimes.Total > 0 {
+			samples = append(samples, latencySample{ping.ResponseTimes.Total, 1})
+		}
+	}
+	report.Checks = checks + len(inWindow)
+	if report.Checks == 0 {
+		return report
+	}
+	switch {
+	case len(inWindow) > 0:
+		report.ServiceName = inWindow[0].ServiceName
+	case len(rollups) > 0:
+		report.ServiceName = rollups[0].ServiceName
+	}
+	report.summarise(spans, samples)
+	return report
+}
+
+//pingSpans returns the spans between each of pings, sorted oldest first, and the next or to for the last
+func pingSpans(pings []configuration.PingResponse, to time.Time) []span {
+	spans := make([]span, 0, len(pings))
+	pageUp := make(map[string]bool)
+	downPages := 0
+	for i, ping := range pings {
+		if up, seen := pageUp[checkKey(ping)]; seen && !up {
+			downPages--
+		}
+		if !ping.Passed {
+			downPages++
+		}
+		pageUp[checkKey(ping)] = ping.Passed
+		end := to
+		if i+1 < len(pings) {
+			end = pings[i+1].TimeGo
+		}
+		spans = append(spans, span{start: ping.TimeGo, end: end, down: downPages > 0})
+	}
+	return spans
+}
+
+//rollupSpans returns the spans of the periods of rollups clipped to from and to, oldest first, with their latency samples and ping count.
+//
+//The order of pings within a period is not kept so each period is taken as down for the share of its pings that failed,
+// at its start, using the worst page of the period for the service. An outage within a period is counted once
+func rollupSpans(rollups []Rollup, from, to time.Time) ([]span, []latencySample, int) {
+	type period struct {
+		start, end time.Time
+		down       float64
+	}
+	periods := make(map[int64]*period)
+	samples := make([]latencySample, 0)
+	checks := 0
+	for _, rollup := range rollups {
+		end := rollup.Start.Add(rollup.Resolution.Duration())
+		if !end.After(from) || !rollup.Start.Before(to) {
+			continue
+		}
+		p, ok := periods[rollup.Start.UnixNano()]
+		if !ok {
+			p = &period{start: rollup.Start, end: end}
+			periods[rollup.Start.UnixNano()] = p
+		}
+		if down := 1 - rollup.Uptime(); down > p.down {
+			p.down = down
+		}
+		checks += int(rollup.Count)
+		for i, count := range rollup.Latency {
+			if count == 0 {
+				continue
+			}
+			//the slowest bucket has no upper bound so use the slowest ping
+			ms := rollup.MaxMs
+			if i < len(LatencyBounds) {
+				ms = LatencyBounds[i]
+			}
+			samples = append(samples, latencySample{ms, count})
+		}
+	}
+	ordered := make([]*period, 0, len(periods))
+	for _, p := range periods {
+		ordered = append(ordered, p)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].start.Before(ordered[j].start) })
+
+	spans := make([]span, 0, 2*len(ordered))
+	for _, p := range ordered {
+		start, end := p.start, p.end
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		downUntil := start.Add(time.Duration(p.down * float64(end.Sub(start))))
+		if downUntil.After(start) {
+			spans = append(spans, span{start: start, end: downUntil, down: true})
+		}
+		if end.After(downUntil) {
+			spans = append(spans, span{start: downUntil, end: end})
+		}
+	}
+	return spans, samples, checks
+}
+
+//summarise sets the availability, outages and latency of the Report from its spans, oldest first, and latency samples
+func (report *Report) summarise(spans []span, samples []latencySample) {
+	var observed, down, outage, repairs time.Duration
+	var recovered int
+	inOutage := false
+	for _, s := range spans {
+		length := s.end.Sub(s.start)
+		observed += length
+		switch {
+		case s.down && !inOutage:
+			report.Outages++
+			inOutage, outage = true, 0
+		case !s.down && inOutage:
+			recovered++
+			repairs += outage
+			inOutage = false
+		}
+		if s.down {
+			down += length
+			outage += length
+		}
+	}
+
+	report.UptimePercent = 100
+	if observed > 0 {
+		report.UptimePercent = float64(observed-down) / float64(observed) * 100
+	} else if inOutage {
+		report.UptimePercent = 0
+	}
+	report.DowntimeMinutes = down.Minutes()
+	report.ObservedMinutes = observed.Minutes()
+	if window := report.To.Sub(report.From); window > 0 {
+		report.CoveragePercent = float64(observed) / float64(window) * 100
+	}
+	if recovered > 0 {
+		report.MTTRMinutes = (repairs / time.Duration(recovered)).Minutes()
+	}
+	if report.Outages > 0 {
+		report.MTBFMinutes = ((observed - down) / time.Duration(report.Outages)).Minutes()
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].ms < samples[j].ms })
+	report.LatencyP50 = percentile(samples, 50)
+	report.LatencyP95 = percentile(samples, 95)
+	report.LatencyP99 = percentile(samples, 99)
+}
+
+//percentile returns the nearest rank percentile p of samples sorted by latency
+func percentile(sorted []latencySample, p float64) int64 {
+	var total int64
+	for _, sample := range sorted {
+		total += sample.count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for _, sample := range sorted {
+		seen += sample.count
+		if seen >= rank {
+			return sample.ms
+		}
+	}
+	return sorted[len(sorted)-1].ms
+}
+
+//withTarget sets the SLO target of the Report and whether it was met. A target of zero sets neither
+func (report *Report) withTarget(sloTarget float64) {
+	if sloTarget <= 0 {
+		return
+	}
+	met := report.Checks > 0 && report.UptimePercent >= sloTarget
+	report.SLOTarget = sloTarget
+	report.SLOMet = &met
+}
+
+//SLA returns the Report of the service between from and to, with a Report for each of its page checks, from the stored history.
+//
+//The part of the window since Retention.Raw is calculated from raw pings and any earlier part from the hourly Rollups,
+// or the daily Rollups past Retention.Hourly. sloTarget is the percentage the service is expected to meet such as
+// Config.SLOTarget, or zero for none
+func (store *Store) SLA(serviceName string, from, to time.Time, sloTarget float64) (Report, error) {
+	now := time.Now()
+	rawFrom := from
+	if start := store.rawStart(now); start.After(from) {
+		rawFrom = start
+		if rawFrom.After(to) {
+			rawFrom = to
+		}
+	}
+	pings := make([]configuration.PingResponse, 0)
+	if rawFrom.Before(to) {
+		var err error
+		if pings, err = store.Pings(Query{ServiceName: serviceName, From: rawFrom, To: to}); err != nil {
+			return Report{}, err
+		}
+	}
+	rollups, err := store.rollupsBetween(serviceName, from, rawFrom, now)
+	if err != nil {
+		return Report{}, err
+	}
+	report := calculate(pings, rollups, from, rawFrom, to)
+	report.ServiceName = serviceName
+	report.withTarget(sloTarget)
+
+	//pages are grouped by check so checks of the same URL with a different method or ID are reported apart
+	pagePings := make(map[string][]configuration.PingResponse)
+	pageRollups := make(map[string][]Rollup)
+	pageURLs := make(map[string]string)
+	checks := make([]string, 0)
+	seen := func(check, url string) {
+		if _, ok := pagePings[check]; !ok {
+			checks = append(checks, check)
+			pagePings[check] = make([]configuration.PingResponse, 0)
+		}
+		pageURLs[check] = url
+	}
+	for _, rollup := range rollups {
+		seen(rollup.checkKey(), rollup.URL)
+		pageRollups[rollup.checkKey()] = append(pageRollups[rollup.checkKey()], rollup)
+	}
+	for _, ping := range pings {
+		seen(checkKey(ping), ping.URL)
+		pagePings[checkKey(ping)] = append(pagePings[checkKey(ping)], ping)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if pageURLs[checks[i]] != pageURLs[checks[j]] {
+			return pageURLs[checks[i]] < pageURLs[checks[j]]
+		}
+		return checks[i] < checks[j]
+	})
+	for _, check := range checks {
+		page := calculate(pagePings[check], pageRollups[check], from, rawFrom, to)
+		page.ServiceName, page.URL = serviceName, pageURLs[check]
+		if check != page.URL {
+			page.CheckID = check
+		}
+		page.withTarget(sloTarget)
+		report.Pages = append(report.Pages, page)
+	}
+	return report, nil
+}
+
+//rawStart returns the time raw pings are kept from at now, rounded up to the hour to line up with the hourly Rollups.
+// Zero if raw pings are kept forever
+func (store *Store) rawStart(now time.Time) time.Time {
+	if store.retention.Raw <= 0 {
+		return time.Time{}
+	}
+	return ceilTime(now.Add(-store.retention.Raw), time.Hour)
+}
+
+//rollupsBetween returns the Rollups of the service covering from to until at now, hourly where still kept and daily before that
+func (store *Store) rollupsBetween(serviceName string, from, until, now time.Time) ([]Rollup, error) {
+	out := make([]Rollup, 0)
+	if !from.Before(until) {
+		return out, nil
+	}
+	hourlyFrom := from
+	if store.retention.Hourly > 0 {
+		if start := ceilTime(now.Add(-store.retention.Hourly), Daily.Duration()); start.After(hourlyFrom) {
+			hourlyFrom = start
+		}
+	}
+	if from.Before(hourlyFrom) {
+		end := hourlyFrom
+		if end.After(until) {
+			end = until
+		}
+		daily, err := store.Rollups(Query{ServiceName: serviceName, From: from.UTC().Truncate(Daily.Duration()), To: end}, Daily)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, daily...)
+	}
+	if hourlyFrom.Before(until) {
+		hourly, err := store.Rollups(Query{ServiceName: serviceName, From: hourlyFrom.UTC().Truncate(time.Hour), To: until}, Hourly)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, hourly...)
+	}
+	return out, nil
+}
+
+//ceilTime rounds t up to a multiple of d
+func ceilTime(t time.Time, d time.Duration) time.Time {
+	if rounded := t.Truncate(d); rounded.Before(t) {
+		return rounded.Add(d)
+	}
+	return t
+}
@@ -0,0 +1,406 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	bolt "go.etcd.io/bbolt"
+)
+
+/*********************************************************
+history is the embedded store of every PingResponse and
+status update Transporter sent by statusSentry, kept in a
+single bbolt file.
+
+Raw records are kept under pings/{service}/{check} and
+updates/{service} keyed by time, where check is the
+CheckID of the page so checks of the same URL with a
+different method or ID are kept apart. Every ping is also
+added to its hourly/{service}/{check} and
+daily/{service}/{check} Rollup as it is recorded, so downsampled history is
+always current. Compact drops each level of data once it
+is older than its Retention.
+
+Record only queues its Transporter so the dispatch Senders
+never wait on disk. A single writer commits the queue in
+batches
+*********************************************************/
+
+var (
+	pingsBucket   = []byte("pings")
+	updatesBucket = []byte("updates")
+)
+
+//queueSize is how many Transporters Record can hold for the writer before it drops them
+const queueSize = 1024
+
+//Store is the history store. Safe for concurrent use
+type Store struct {
+	db        *bolt.DB
+	retention Retention
+
+	mu      sync.RWMutex //mu guards closed and sends on queue
+	closed  bool
+	queue   chan pending
+	written chan struct{} //written is closed when the writer has committed everything queued and exited
+}
+
+//pending is a Transporter queued by Record. A pending with flushed set is a marker closed once everything queued before it is written
+type pending struct {
+	t       configuration.Transporter
+	flushed chan struct{}
+}
+
+//Retention is how long each level of history is kept. Zero keeps it forever
+type Retention struct {
+	Raw    time.Duration //Raw is how long every PingResponse and status update is kept
+	Hourly time.Duration //Hourly is how long hourly Rollups are kept
+	Daily  time.Duration //Daily is how long daily Rollups are kept
+}
+
+//DefaultRetention keeps raw records for a week, hourly rollups for 90 days and daily rollups for two years
+func DefaultRetention() Retention {
+	return Retention{
+		Raw:    7 * 24 * time.Hour,
+		Hourly: 90 * 24 * time.Hour,
+		Daily:  2 * 365 * 24 * time.Hour,
+	}
+}
+
+//Open opens, or creates, the history store at path
+func Open(path string, retention Retention) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open history store %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{pingsBucket, updatesBucket, []byte(Hourly), []byte(Daily)} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not set up history store %s: %v", path, err)
+	}
+	store := &Store{db: db, retention: retention, queue: make(chan pending, queueSize), written: make(chan struct{})}
+	go store.write()
+	return store, nil
+}
+
+//Close writes everything queued by Record then closes the store file
+func (store *Store) Close() error {
+	store.mu.Lock()
+	if !store.closed {
+		store.closed = true
+		close(store.queue)
+	}
+	store.mu.Unlock()
+	<-store.written
+	return store.db.Close()
+}
+
+//Flush waits until everything queued by Record so far is written
+func (store *Store) Flush() {
+	flushed := make(chan struct{})
+	store.mu.RLock()
+	if store.closed {
+		store.mu.RUnlock()
+		return
+	}
+	store.queue <- pending{flushed: flushed}
+	store.mu.RUnlock()
+	<-flushed
+}
+
+//write commits the queued Transporters until the queue is closed. Everything waiting when a batch starts is committed in one transaction
+func (store *Store) write() {
+	defer close(store.written)
+	for next := range store.queue {
+		batch := []pending{next}
+	drain:
+		for len(batch) < queueSize {
+			select {
+			case more, ok := <-store.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, more)
+			default:
+				break drain
+			}
+		}
+		err := store.db.Batch(func(tx *bolt.Tx) error {
+			for _, queued := range batch {
+				if queued.flushed != nil {
+					continue
+				}
+				if err := putTransporter(tx, queued.t); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("error writing %d record(s) to the history store: %v", len(batch), err)
+		}
+		for _, queued := range batch {
+			if queued.flushed != nil {
+				close(queued.flushed)
+			}
+		}
+	}
+}
+
+//Query selects the history of a service, or of every service if ServiceName is empty,
+// optionally narrowed to a single page check, between From and To
+type Query struct {
+	ServiceName string
+	CheckID     string    //CheckID narrows pings and rollups to a single page check. See checkKey. Not used for status updates
+	From        time.Time //From is the inclusive start of the range. Zero for the start of history
+	To          time.Time //To is the exclusive end of the range. Zero for now
+}
+
+//bounds returns the time keys bounding the Query
+func (query Query) bounds() (from, to []byte) {
+	end := query.To
+	if end.IsZero() {
+		end = time.Now().Add(time.Nanosecond)
+	}
+	return timeKey(query.From, 0), timeKey(end, 0)
+}
+
+//StatusUpdate is a status update Transporter with the time it was recorded under
+type StatusUpdate struct {
+	Time time.Time `json:"time"`
+	configuration.Transporter
+}
+
+//pingRecord is a stored PingResponse along with its fields that are not part of its JSON
+type pingRecord struct {
+	ServiceName string                     `json:"service_name"`
+	Domain      string                     `json:"domain,omitempty"`
+	StatusPage  string                     `json:"status_page,omitempty"`
+	Ping        configuration.PingResponse `json:"ping"`
+}
+
+//Record queues a Transporter to be stored by the writer without waiting for it to be written. See putTransporter.
+// Transporters are dropped with an error once the queue is full or the store is closed
+//
+//Implements dispatch.Recorder
+func (store *Store) Record(t configuration.Transporter) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if store.closed {
+		return fmt.Errorf("history store is closed")
+	}
+	//copy the PingResponse as the caller may reuse it before the writer gets to it
+	if t.PingResponse != nil {
+		ping := *t.PingResponse
+		t.PingResponse = &ping
+	}
+	select {
+	case store.queue <- pending{t: t}:
+		return nil
+	default:
+		return fmt.Errorf("history store queue is full - record dropped")
+	}
+}
+
+//RecordPing stores ping and adds it to its hourly and daily Rollups, waiting for it to be written
+func (store *Store) RecordPing(ping configuration.PingResponse) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return putPing(tx, ping)
+	})
+}
+
+//RecordUpdate stores a status update under the service DisplayServiceName at its published time if known, otherwise now.
+// Waits for it to be written
+func (store *Store) RecordUpdate(t configuration.Transporter) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return putUpdate(tx, t)
+	})
+}
+
+//putTransporter stores t in tx: as a ping if it carries a PingResponse, otherwise with the status updates
+// of its service. State changes are kept with the status updates too
+func putTransporter(tx *bolt.Tx, t configuration.Transporter) error {
+	if t.Type() == configuration.EventPing && t.PingResponse != nil {
+		return putPing(tx, *t.PingResponse)
+	}
+	return putUpdate(tx, t)
+}
+
+//putPing stores ping in tx and adds it to its hourly and daily Rollups
+func putPing(tx *bolt.Tx, ping configuration.PingResponse) error {
+	if ping.TimeGo.IsZero() {
+		ping.TimeGo = time.Now()
+	}
+	raw, err := json.Marshal(pingRecord{ServiceName: ping.ServiceName, Domain: ping.Domain, StatusPage: ping.StatusPage, Ping: ping})
+	if err != nil {
+		return err
+	}
+	bucket, err := nestedBucket(tx, pingsBucket, ping.ServiceName, checkKey(ping))
+	if err != nil {
+		return err
+	}
+	seq, _ := bucket.NextSequence()
+	if err := bucket.Put(timeKey(ping.TimeGo, seq), raw); err != nil {
+		return err
+	}
+	for _, resolution := range []Resolution{Hourly, Daily} {
+		if err := addToRollup(tx, resolution, ping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//putUpdate stores a status update in tx under the service DisplayServiceName at its published time if known, otherwise now
+func putUpdate(tx *bolt.Tx, t configuration.Transporter) error {
+	at, err := time.Parse(time.RFC3339, t.MessagePublishedDateTime)
+	if err != nil {
+		at = time.Now()
+	}
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	bucket, err := nestedBucket(tx, updatesBucket, t.DisplayServiceName)
+	if err != nil {
+		return err
+	}
+	seq, _ := bucket.NextSequence()
+	return bucket.Put(timeKey(at, seq), raw)
+}
+
+//Pings returns the stored PingResponses matching query, oldest first
+func (store *Store) Pings(query Query) ([]configuration.PingResponse, error) {
+	out := make([]configuration.PingResponse, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return eachInRange(tx.Bucket(pingsBucket), query, true, func(key, value []byte) error {
+			var record pingRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			ping := record.Ping
+			ping.ServiceName, ping.Domain, ping.StatusPage = record.ServiceName, record.Domain, record.StatusPage
+			ping.TimeGo = keyTime(key)
+			out = append(out, ping)
+			return nil
+		})
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].TimeGo.Before(out[j].TimeGo) })
+	return out, err
+}
+
+//StatusUpdates returns the stored status updates matching query, oldest first
+func (store *Store) StatusUpdates(query Query) ([]StatusUpdate, error) {
+	out := make([]StatusUpdate, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return eachInRange(tx.Bucket(updatesBucket), query, false, func(key, value []byte) error {
+			update := StatusUpdate{Time: keyTime(key)}
+			if err := json.Unmarshal(value, &update.Transporter); err != nil {
+				return err
+			}
+			out = append(out, update)
+			return nil
+		})
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, err
+}
+
+//nestedBucket returns, creating as needed, the bucket at the path of names below the top level bucket root
+func nestedBucket(tx *bolt.Tx, root []byte, names ...string) (*bolt.Bucket, error) {
+	bucket := tx.Bucket(root)
+	for _, name := range names {
+		if name == "" { //bbolt does not allow empty bucket names
+			name = "-"
+		}
+		next, err := bucket.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return nil, err
+		}
+		bucket = next
+	}
+	return bucket, nil
+}
+
+//checkKey returns the key of the page check of ping in the store: its CheckID, or its URL for pings without one
+func checkKey(ping configuration.PingResponse) string {
+	if ping.CheckID != "" {
+		return ping.CheckID
+	}
+	return ping.URL
+}
+
+//eachInRange calls fn for every record of root in the service, and if byCheck the page check, buckets matching query within its time range
+func eachInRange(root *bolt.Bucket, query Query, byCheck bool, fn func(key, value []byte) error) error {
+	from, to := query.bounds()
+	scan := func(bucket *bolt.Bucket) error {
+		c := bucket.Cursor()
+		for key, value := c.Seek(from); key != nil && string(key) < string(to); key, value = c.Next() {
+			if value == nil { //nested bucket
+				continue
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return eachBucket(root, query.ServiceName, func(service *bolt.Bucket) error {
+		if !byCheck {
+			return scan(service)
+		}
+		return eachBucket(service, query.CheckID, scan)
+	})
+}
+
+//eachBucket calls fn with the bucket of parent called name, or every bucket of parent if name is empty
+func eachBucket(parent *bolt.Bucket, name string, fn func(*bolt.Bucket) error) error {
+	if name != "" {
+		if bucket := parent.Bucket([]byte(name)); bucket != nil {
+			return fn(bucket)
+		}
+		return nil
+	}
+	return parent.ForEach(func(key, value []byte) error {
+		if value != nil {
+			return nil
+		}
+		return fn(parent.Bucket(key))
+	})
+}
+
+//timeKey returns a key ordered by time with seq to keep records at the same time apart
+func timeKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	nanos := int64(0)
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	if nanos < 0 {
+		nanos = 0
+	}
+	binary.BigEndian.PutUint64(key[:8], uint64(nanos))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+//keyTime returns the time of a timeKey
+func keyTime(key []byte) time.Time {
+	if len(key) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
@@ -0,0 +1,124 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*********************************************************
+jsonpath is a minimal JSONPath implementation for picking
+single values out of decoded JSON documents.
+
+Supports the root $ followed by any number of .name,
+['name'] or [index] steps. Negative indexes count from
+the end of an array. Wildcards, filters and slices are
+not supported
+*********************************************************/
+
+//Path is a parsed JSONPath expression
+type Path struct {
+	raw   string
+	steps []step
+}
+
+//step is a single object key or array index in a Path
+type step struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+//Parse parses a JSONPath expression such as $.data[0].status or $['status page'].state
+func Parse(raw string) (Path, error) {
+	path := Path{raw: raw}
+	expr := strings.TrimSpace(raw)
+	if !strings.HasPrefix(expr, "$") {
+		return path, fmt.Errorf("json path %q must start with $", raw)
+	}
+	expr = expr[1:]
+	for expr != "" {
+		switch expr[0] {
+		case '.':
+			expr = expr[1:]
+			end := strings.IndexAny(expr, ".[")
+			if end < 0 {
+				end = len(expr)
+			}
+			if end == 0 {
+				return path, fmt.Errorf("json path %q has an empty name", raw)
+			}
+			path.steps = append(path.steps, step{key: expr[:end]})
+			expr = expr[end:]
+		case '[':
+			end := strings.Index(expr, "]")
+			if end < 0 {
+				return path, fmt.Errorf("json path %q has an unclosed [", raw)
+			}
+			inner := strings.TrimSpace(expr[1:end])
+			expr = expr[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path.steps = append(path.steps, step{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return path, fmt.Errorf("json path %q has an unsupported selector [%s]", raw, inner)
+			}
+			path.steps = append(path.steps, step{index: index, isIndex: true})
+		default:
+			return path, fmt.Errorf("json path %q has an unexpected %q", raw, expr[0])
+		}
+	}
+	return path, nil
+}
+
+func (path Path) String() string {
+	return path.raw
+}
+
+//Lookup returns the value at the Path within doc, a document decoded by encoding/json into an interface{}.
+//
+//Returns false if any step of the Path does not exist
+func (path Path) Lookup(doc interface{}) (interface{}, bool) {
+	current := doc
+	for _, st := range path.steps {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if st.isIndex {
+				return nil, false
+			}
+			next, ok := node[st.key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			if !st.isIndex {
+				return nil, false
+			}
+			i := st.index
+			if i < 0 {
+				i += len(node)
+			}
+			if i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+//LookupJSON decodes raw JSON and returns the value at the Path
+func (path Path) LookupJSON(raw []byte) (interface{}, bool, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, false, err
+	}
+	value, ok := path.Lookup(doc)
+	return value, ok, nil
+}
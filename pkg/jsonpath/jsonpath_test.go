@@ -0,0 +1,34 @@
+package jsonpath
+
+import "testing"
+
+func TestLookupJSON(t *testing.T) {
+	raw := []byte(`{"status":{"indicator":"none"},"components":[{"name":"API","state":"up"},{"name":"web ui","state":"down"}],"odd key":1}`)
+	cases := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"$.status.indicator", "none", true},
+		{"$.components[0].name", "API", true},
+		{"$.components[-1]['state']", "down", true},
+		{"$['odd key']", 1.0, true},
+		{"$.components[2].name", nil, false},
+		{"$.status[0]", nil, false},
+	}
+	for _, tc := range cases {
+		path, err := Parse(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		got, ok, err := path.LookupJSON(raw)
+		if err != nil || ok != tc.found || got != tc.want {
+			t.Errorf("%s: got %v %v %v", tc.path, got, ok, err)
+		}
+	}
+	for _, bad := range []string{"status", "$.", "$[0", "$[*]"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q not to parse", bad)
+		}
+	}
+}
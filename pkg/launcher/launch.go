@@ -3,14 +3,19 @@ package launcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"github.com/karlsburg87/statusSentry/pkg/dispatch"
+	"github.com/karlsburg87/statusSentry/pkg/history"
 	"github.com/karlsburg87/statusSentry/pkg/pinger"
 	statuscheck "github.com/karlsburg87/statusSentry/pkg/statusCheck"
 )
@@ -18,12 +23,34 @@ import (
 //---------------------------------------------
 // Helper functions
 //---------------------------------------------
-var configLocation string
+var (
+	configLocation string
+	//configPollInterval is how often remote config locations are polled for changes. Zero switches polling off
+	configPollInterval time.Duration
+	//refreshPort is the port of the config refresh server
+	refreshPort int
+	//historyPath is the file of the history store. Empty switches the store off
+	historyPath string
+	//historyRetention is how long each level of the history store is kept
+	historyRetention history.Retention
+	//startupDocs are the documents last fetched by GetConfigurationFile by config location.
+	// They seed the reloader so its first check of each location is a conditional refetch
+	startupDocs   = map[string][]*configuration.Document{}
+	startupDocsMu sync.Mutex
+)
+
+//historyCompactInterval is how often data past its retention is removed from the history store
+const historyCompactInterval = time.Hour
 
 //ServerConfig is the config passed to confiRefreshServer to run a server according to envar configs
 type ServerConfig struct {
 	StatusChecker serverService
 	Pinger        serverService
+	//History is the store of every ping and status update sent. Nil unless HISTORY_PATH is set
+	History *history.Store
+
+	//reloader pushes new versions of the configuration to the services. Shared by the refresh server and config watcher
+	reloader *reloader
 }
 
 //ServerService specifies the channel and whether the service should be used in this runtime
@@ -37,6 +64,37 @@ func init() {
 	if configLocation == "" {
 		configLocation = "" //TODO: default location to go here
 	}
+	configPollInterval = 5 * time.Minute
+	if raw := os.Getenv("CONFIG_POLL_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Panicf("CONFIG_POLL_INTERVAL must be a Go duration string e.g. 5m: %v", err)
+		}
+		configPollInterval = interval
+	}
+	refreshPort = 8099
+	if raw := os.Getenv("CONFIG_REFRESH_PORT"); raw != "" {
+		port, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Panicln(err)
+		}
+		refreshPort = port
+	}
+	historyPath = os.Getenv("HISTORY_PATH")
+	historyRetention = history.DefaultRetention()
+	for envar, retention := range map[string]*time.Duration{
+		"HISTORY_RAW_RETENTION":    &historyRetention.Raw,
+		"HISTORY_HOURLY_RETENTION": &historyRetention.Hourly,
+		"HISTORY_DAILY_RETENTION":  &historyRetention.Daily,
+	} {
+		if raw := os.Getenv(envar); raw != "" {
+			keep, err := time.ParseDuration(raw)
+			if err != nil {
+				log.Panicf("%s must be a Go duration string e.g. 168h: %v", envar, err)
+			}
+			*retention = keep
+		}
+	}
 }
 
 //Setup runs the Launcher for pinger and statusChecker unless a X_ONLY config envar has been set. Returns channels to running services and a cancelfunc. Non running services will have chan as nil
@@ -56,6 +114,19 @@ func Setup(conf *configuration.Configuration) (serverConfig ServerConfig, cancel
 		statusCheckOnly = false
 		pingerOnly = false
 	}
+	//keep the history of everything sent if a store is configured. Registered before the services start sending
+	if historyPath != "" {
+		store, err := history.Open(historyPath, historyRetention)
+		if err != nil {
+			log.Panicln(err)
+		}
+		dispatch.AddRecorder(store)
+		serverConfig.History = store
+		go func() {
+			store.Run(ctx, historyCompactInterval)
+			store.Close()
+		}()
+	}
 	//start status page checkers
 	if !pingerOnly {
 		serverConfig.StatusChecker.Active = true
@@ -70,47 +141,92 @@ func Setup(conf *configuration.Configuration) (serverConfig ServerConfig, cancel
 		pinger.Launch(ctx, serverConfig.Pinger.Channel)
 		serverConfig.Pinger.Channel <- conf //send initial config data pointer to ping processors
 	}
+	//watch config files and poll remote config locations for changes
+	serverConfig.reloader = newReloader(serverConfig, configLocation, conf)
+	go serverConfig.reloader.watch(ctx, configPollInterval)
 	return
 }
 
-//GetConfigurationFile fetches the configuration file and
+//GetConfigurationFile fetches the configuration file(s) from the comma separated locations in locationOfConfigFile
+// and merges them into a single validated Configuration.
+//
+//Each location is resolved by its scheme: file:// or a plain path, http(s):// or gs://bucket/object.
+// Files may be JSON or YAML. The built in test configuration is returned if no location is given.
+//
+//A Configuration that fails validation returns a *configuration.ValidationError listing every problem
 func GetConfigurationFile(locationOfConfigFile string) (*configuration.Configuration, error) {
-	//get config
-	//return configuration.FetchConfig(http.DefaultClient, configLocation)
+	var conf *configuration.Configuration
+	var err error
+	if locationOfConfigFile == "" {
+		log.Println("CONFIG_LOCATION not set - using the built in test config")
+		conf, err = configuration.FetchTestConfig()
+	} else {
+		var docs []*configuration.Document
+		conf, docs, err = configuration.LoadDocuments(context.Background(), locationOfConfigFile)
+		if err == nil {
+			startupDocsMu.Lock()
+			startupDocs[locationOfConfigFile] = docs
+			startupDocsMu.Unlock()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
 
-	return configuration.FetchTestConfig() //FIXME: change to FetchConfig when sending to production
+//takeStartupDocs returns and forgets the documents GetConfigurationFile last fetched from location
+func takeStartupDocs(location string) []*configuration.Document {
+	startupDocsMu.Lock()
+	defer startupDocsMu.Unlock()
+	docs := startupDocs[location]
+	delete(startupDocs, location)
+	return docs
 }
 
 //RefreshConfigServer is a server setup to listen exclusively for signal to
 // reload the config data from CONFIG_LOCATION set as an environment variable
+//
+//Listens on CONFIG_REFRESH_PORT, defaulting to 8099
 func RefreshConfigServer(config ServerConfig) *http.Server {
-	refreshPort := 8099
+	if config.reloader == nil {
+		config.reloader = newReloader(config, configLocation, nil)
+	}
 	refreshMux := http.NewServeMux()
 	refreshMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintln(w, "This endpoint is not for public consumption")
 	})
 	refreshMux.HandleFunc("/config/refresh", func(w http.ResponseWriter, r *http.Request) {
-		newConfig, err := GetConfigurationFile("")
+		changed, diff, err := config.reloader.reload(r.Context())
 		if err != nil {
+			//keep the running config and report why the new one was rejected
+			log.Printf("config refresh rejected - keeping current config: %v", err)
+			var invalid *configuration.ValidationError
+			if errors.As(err, &invalid) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "invalid", "note": "Config rejected. The current config is still running", "problems": invalid.Problems})
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"status": "error", "note": "Oops something went wrong.\nPlease contact the administrator", "error_msg": err.Error()})
-			log.Fatalln(err)
-		}
-		if config.StatusChecker.Active {
-			config.StatusChecker.Channel <- newConfig //statusPage checking functions
-		}
-		if config.Pinger.Active {
-			config.Pinger.Channel <- newConfig //pinger functions
+			return
 		}
-		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "changed": changed, "diff": diff})
 	})
+	//availability reports from the history store
+	refreshMux.HandleFunc("/sla", slaHandler(config))
+	//metrics such as the inbound_accepted and inbound_rejected counts of the webhook server
+	refreshMux.Handle("/debug/vars", expvar.Handler())
 	refreshServer := &http.Server{
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		IdleTimeout:       20 * time.Second,
-		Handler:           http.NewServeMux(),
+		Handler:           refreshMux,
 		Addr:              fmt.Sprintf(":%d", refreshPort),
 	}
 	log.Printf("Config refresh server created on port %d\n", refreshPort)
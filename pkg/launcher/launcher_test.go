@@ -0,0 +1,195 @@
+package launcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"github.com/karlsburg87/statusSentry/pkg/history"
+)
+
+const testConfig = `[{"service_name":"Stripe","status_source":"twitter:@stripestatus","poll_frequency":"1m","poll_pages":["https://www.stripe.com"]}]`
+
+//newTestServerConfig returns a ServerConfig with buffered channels so pushes can be inspected without running services
+func newTestServerConfig() ServerConfig {
+	return ServerConfig{
+		StatusChecker: serverService{Channel: make(chan *configuration.Configuration, 10), Active: true},
+		Pinger:        serverService{Channel: make(chan *configuration.Configuration, 10), Active: true},
+	}
+}
+
+func TestReloaderFileWatch(t *testing.T) {
+	ctx := context.Background()
+	location := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		if err := os.WriteFile(location, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		//move the modification time on so the change is seen on filesystems with coarse timestamps
+		later := time.Now().Add(time.Duration(len(content)) * time.Second)
+		if err := os.Chtimes(location, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(testConfig)
+	initial, err := GetConfigurationFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := newTestServerConfig()
+	r := newReloader(services, location, initial)
+
+	//same content reformatted must not be pushed
+	r.check(ctx, isLocalLocation, "test")
+	write("\n  " + testConfig + "\n")
+	r.check(ctx, isLocalLocation, "test")
+	if len(services.Pinger.Channel) != 0 || len(services.StatusChecker.Channel) != 0 {
+		t.Fatal("expected no push for unchanged config content")
+	}
+
+	//invalid config must be rejected and the current config kept
+	write(`[{"service_name":"","poll_pages":["not a url"]}]`)
+	r.check(ctx, isLocalLocation, "test")
+	if len(services.Pinger.Channel) != 0 {
+		t.Fatal("expected no push for an invalid config")
+	}
+
+	//changed content is pushed to every active service
+	write(`[{"service_name":"Stripe","status_source":"twitter:@stripestatus","poll_frequency":"2m","poll_pages":["https://www.stripe.com"]}]`)
+	r.check(ctx, isLocalLocation, "test")
+	if len(services.Pinger.Channel) != 1 || len(services.StatusChecker.Channel) != 1 {
+		t.Fatalf("expected one push per service, got %d and %d", len(services.Pinger.Channel), len(services.StatusChecker.Channel))
+	}
+	if pushed := <-services.Pinger.Channel; time.Duration((*pushed)[0].PollFrequency) != 2*time.Minute {
+		t.Errorf("unexpected pushed config %+v", *pushed)
+	}
+}
+
+func TestReloaderRemotePoll(t *testing.T) {
+	requests, conditional := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(testConfig))
+	}))
+	defer server.Close()
+
+	services := newTestServerConfig()
+	r := newReloader(services, server.URL, nil)
+	remote := func(location string) bool { return !isLocalLocation(location) }
+	r.check(context.Background(), remote, "test")
+	r.check(context.Background(), remote, "test")
+	r.check(context.Background(), remote, "test")
+	if requests != 3 || conditional != 2 {
+		t.Errorf("expected 1 full and 2 conditional requests, got %d requests with %d conditional", requests, conditional)
+	}
+	if len(services.Pinger.Channel) != 1 {
+		t.Errorf("expected a single push, got %d", len(services.Pinger.Channel))
+	}
+}
+
+func TestReloaderSeededFromStartup(t *testing.T) {
+	full := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(testConfig))
+	}))
+	defer server.Close()
+
+	initial, err := GetConfigurationFile(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := newTestServerConfig()
+	r := newReloader(services, server.URL, initial)
+	r.check(context.Background(), func(location string) bool { return !isLocalLocation(location) }, "test")
+	if full != 1 {
+		t.Errorf("expected only the startup fetch in full, got %d full fetches", full)
+	}
+}
+
+func TestReloaderPushesOutsideLock(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(location, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//unbuffered channels with nothing receiving block the push
+	services := ServerConfig{Pinger: serverService{Channel: make(chan *configuration.Configuration), Active: true}}
+	r := newReloader(services, location, nil)
+	go r.check(context.Background(), isLocalLocation, "test")
+
+	done := make(chan *configuration.Configuration)
+	go func() {
+		for {
+			if conf := r.configuration(); conf != nil {
+				done <- conf
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the running config blocked on a pending push")
+	}
+	<-services.Pinger.Channel
+}
+
+func TestSLAHandler(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"), history.DefaultRetention())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	for i, passed := range []bool{true, true, false, true} {
+		ping := configuration.PingResponse{ServiceName: "Stripe", URL: "https://www.stripe.com", Passed: passed, TimeGo: now.Add(time.Duration(i-4) * time.Hour)}
+		if err := store.RecordPing(ping); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf := &configuration.Configuration{{ServiceName: "Stripe", PollFrequency: configuration.Frequency(time.Minute), PollPages: []configuration.PollPage{{URL: "https://www.stripe.com"}}, SLOTarget: 99}}
+	services := newTestServerConfig()
+	services.History = store
+	services.reloader = newReloader(services, "", conf)
+	handler := slaHandler(services)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/sla?window=24h", nil))
+	reports := make([]history.Report, 0)
+	if err := json.NewDecoder(rec.Body).Decode(&reports); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", rec.Code, err)
+	}
+	if len(reports) != 1 || reports[0].Checks != 4 || reports[0].Outages != 1 || reports[0].SLOMet == nil || *reports[0].SLOMet || len(reports[0].Pages) != 1 {
+		t.Errorf("unexpected reports %+v", reports)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/sla?from=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad request for an invalid from, got %d", rec.Code)
+	}
+	services.History = nil
+	rec = httptest.NewRecorder()
+	slaHandler(services)(rec, httptest.NewRequest(http.MethodGet, "/sla", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected unavailable without a history store, got %d", rec.Code)
+	}
+}
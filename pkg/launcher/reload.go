@@ -0,0 +1,212 @@
+package launcher
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//fileWatchInterval is how often local config files are checked for changes
+const fileWatchInterval = 5 * time.Second
+
+//reloader owns the running configuration and pushes new versions of it down the channels of the active services
+//
+//mu guards docs, current and hash and is never held during a fetch or a push. pushMu orders pushes
+// so the services receive configurations in the order they were applied
+type reloader struct {
+	mu       sync.Mutex
+	pushMu   sync.Mutex
+	services ServerConfig
+	location string                    //location is the comma separated list of config locations. See GetConfigurationFile
+	docs     []*configuration.Document //docs are the most recently fetched documents of each config location in order
+	current  *configuration.Configuration
+	hash     string //hash is the content hash of current
+}
+
+//newReloader returns a reloader for the services in serverConfig that are already running initial.
+// The documents initial was loaded from by GetConfigurationFile are kept so they are only refetched conditionally
+func newReloader(serverConfig ServerConfig, location string, initial *configuration.Configuration) *reloader {
+	r := &reloader{
+		services: serverConfig,
+		location: location,
+		current:  initial,
+	}
+	if initial != nil {
+		if docs := takeStartupDocs(location); len(docs) == len(configuration.SplitLocations(location)) {
+			r.docs = docs
+		}
+		hash, err := initial.Hash()
+		if err != nil {
+			log.Printf("could not hash initial config: %v", err)
+		}
+		r.hash = hash
+	}
+	return r
+}
+
+//reload fetches every config location in full and applies the result if its content has changed.
+//
+//Returns whether a new configuration was pushed to the services and how it differs from the previous one
+func (r *reloader) reload(ctx context.Context) (bool, configuration.Diff, error) {
+	if r.location == "" {
+		conf, err := GetConfigurationFile("")
+		if err != nil {
+			return false, configuration.Diff{}, err
+		}
+		return r.apply(conf, "refresh")
+	}
+	docs := make([]*configuration.Document, 0)
+	for _, location := range configuration.SplitLocations(r.location) {
+		doc, err := configuration.Fetch(ctx, location)
+		if err != nil {
+			log.Printf("config reload failed: %v", err)
+			return false, configuration.Diff{}, err
+		}
+		docs = append(docs, doc)
+	}
+	return r.applyDocs(docs, "refresh")
+}
+
+//check conditionally refetches the config locations selected by include and applies the
+// result if any of them changed. Failures are logged and the running configuration is kept
+func (r *reloader) check(ctx context.Context, include func(location string) bool, trigger string) {
+	locations := configuration.SplitLocations(r.location)
+	docs := make([]*configuration.Document, len(locations))
+	r.mu.Lock()
+	copy(docs, r.docs)
+	r.mu.Unlock()
+	changed := false
+	for i, location := range locations {
+		if !include(location) {
+			continue
+		}
+		var doc *configuration.Document
+		var updated bool
+		var err error
+		if docs[i] == nil {
+			doc, err = configuration.Fetch(ctx, location)
+			updated = true
+		} else {
+			doc, updated, err = configuration.Refetch(ctx, docs[i])
+		}
+		if err != nil {
+			log.Printf("config reload (%s) failed - keeping current config: %v", trigger, err)
+			return
+		}
+		docs[i] = doc
+		changed = changed || updated
+	}
+	if !changed {
+		return
+	}
+	//docs with no fetch yet are those not selected by include so fetch them in full before decoding
+	for i, location := range locations {
+		if docs[i] != nil {
+			continue
+		}
+		doc, err := configuration.Fetch(ctx, location)
+		if err != nil {
+			log.Printf("config reload (%s) failed - keeping current config: %v", trigger, err)
+			return
+		}
+		docs[i] = doc
+	}
+	r.applyDocs(docs, trigger)
+}
+
+//applyDocs records docs as the latest fetched documents then decodes, merges and applies them
+func (r *reloader) applyDocs(docs []*configuration.Document, trigger string) (bool, configuration.Diff, error) {
+	//record the fetched versions even if they fail validation so a bad file is reported once rather than every check
+	r.mu.Lock()
+	r.docs = docs
+	r.mu.Unlock()
+	conf, err := configuration.Decode(docs...)
+	if err != nil {
+		log.Printf("config reload (%s) failed - keeping current config: %v", trigger, err)
+		return false, configuration.Diff{}, err
+	}
+	return r.apply(conf, trigger)
+}
+
+//apply validates conf and pushes it to the services only if its content hash differs from the running config
+func (r *reloader) apply(conf *configuration.Configuration, trigger string) (bool, configuration.Diff, error) {
+	if err := conf.Validate(); err != nil {
+		log.Printf("config reload (%s) failed - keeping current config: %v", trigger, err)
+		return false, configuration.Diff{}, err
+	}
+	hash, err := conf.Hash()
+	if err != nil {
+		log.Printf("config reload (%s) failed - keeping current config: %v", trigger, err)
+		return false, configuration.Diff{}, err
+	}
+	r.pushMu.Lock()
+	defer r.pushMu.Unlock()
+	r.mu.Lock()
+	diff := configuration.DiffConfigurations(r.current, conf)
+	if hash == r.hash {
+		r.mu.Unlock()
+		log.Printf("config reload (%s): content unchanged", trigger)
+		return false, diff, nil
+	}
+	r.current = conf
+	r.hash = hash
+	r.mu.Unlock()
+
+	log.Printf("config reload (%s) succeeded: %s", trigger, diff)
+	if r.services.StatusChecker.Active {
+		r.services.StatusChecker.Channel <- conf //statusPage checking functions
+	}
+	if r.services.Pinger.Active {
+		r.services.Pinger.Channel <- conf //pinger functions
+	}
+	return true, diff, nil
+}
+
+//watch checks local config files for changes every fileWatchInterval and remote config locations
+// every pollInterval until ctx is cancelled. A pollInterval of zero switches off remote polling
+func (r *reloader) watch(ctx context.Context, pollInterval time.Duration) {
+	if r.location == "" {
+		return
+	}
+	fileTckr := time.NewTicker(fileWatchInterval)
+	defer fileTckr.Stop()
+	var remote <-chan time.Time
+	if pollInterval > 0 {
+		remoteTckr := time.NewTicker(pollInterval)
+		defer remoteTckr.Stop()
+		remote = remoteTckr.C
+	}
+	log.Printf("watching config location(s) %q - remote poll interval %s", r.location, pollInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fileTckr.C:
+			r.check(ctx, isLocalLocation, "file watch")
+		case <-remote:
+			r.check(ctx, func(location string) bool { return !isLocalLocation(location) }, "remote poll")
+		}
+	}
+}
+
+//isLocalLocation reports whether a config location is a file on the local filesystem
+func isLocalLocation(location string) bool {
+	uri, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	return uri.Scheme == "" || strings.EqualFold(uri.Scheme, "file")
+}
+
+//configuration returns the running configuration
+func (r *reloader) configuration() *configuration.Configuration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
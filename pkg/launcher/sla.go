@@ -0,0 +1,100 @@
+package launcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/history"
+)
+
+//defaultSLAWindow is the window of an SLA report when no from or window is requested
+const defaultSLAWindow = 30 * 24 * time.Hour
+
+//slaHandler reports the uptime, downtime, MTTR, MTBF and latency percentiles of services from the history store.
+//
+//Query parameters:
+//
+//- service: the ServiceName to report on. Every service with poll_pages in the running config if not given
+//
+//- from and to: the RFC3339 window of the report. to defaults to now
+//
+//- window: a Go duration string used instead of from e.g. 720h. Defaults to 30 days
+func slaHandler(config ServerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if config.History == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "error", "note": "The history store is off. Set HISTORY_PATH to keep ping history"})
+			return
+		}
+		from, to, err := slaWindow(r, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"status": "error", "error_msg": err.Error()})
+			return
+		}
+
+		//the SLO target of each service comes from the running config
+		targets := make(map[string]float64)
+		services := make([]string, 0)
+		if conf := config.reloader.configuration(); conf != nil {
+			for _, item := range *conf {
+				targets[item.ServiceName] = item.SLOTarget
+				if len(item.PollPages) > 0 {
+					services = append(services, item.ServiceName)
+				}
+			}
+		}
+		if service := r.URL.Query().Get("service"); service != "" {
+			services = []string{service}
+		}
+
+		reports := make([]history.Report, 0, len(services))
+		for _, service := range services {
+			report, err := config.History.SLA(service, from, to, targets[service])
+			if err != nil {
+				log.Printf("error calculating SLA of %s: %v", service, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"status": "error", "error_msg": err.Error()})
+				return
+			}
+			reports = append(reports, report)
+		}
+		json.NewEncoder(w).Encode(reports)
+	}
+}
+
+//slaWindow returns the window requested by the from, to and window query parameters of r
+func slaWindow(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	query := r.URL.Query()
+	to = now
+	if raw := query.Get("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, fmt.Errorf("to must be an RFC3339 time: %v", err)
+		}
+	}
+	from = to.Add(-defaultSLAWindow)
+	if raw := query.Get("window"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return from, to, fmt.Errorf("window must be a positive Go duration string e.g. 720h")
+		}
+		from = to.Add(-window)
+	}
+	if raw := query.Get("from"); raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, fmt.Errorf("from must be an RFC3339 time: %v", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
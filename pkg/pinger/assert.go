@@ -0,0 +1,110 @@
+package pinger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"github.com/karlsburg87/statusSentry/pkg/jsonpath"
+)
+
+//maxBodyBytes is the most of a response body read for assertions on it
+const maxBodyBytes = 1 << 20
+
+//evaluateAssertions checks a response against the status codes and Assertions of page
+// and returns a description of each one that failed. An empty result means the response passed
+func evaluateAssertions(page configuration.PollPage, statusCode int, body []byte, elapsed time.Duration, tlsState *tls.ConnectionState) []string {
+	failed := make([]string, 0)
+	if !page.IsExpectedStatus(statusCode) {
+		failed = append(failed, fmt.Sprintf("status %d is not an accepted status code", statusCode))
+	}
+	assertions := page.Assertions
+	if assertions == nil {
+		return failed
+	}
+
+	for _, keyword := range assertions.BodyContains {
+		if !bytes.Contains(body, []byte(keyword)) {
+			failed = append(failed, fmt.Sprintf("body does not contain %q", keyword))
+		}
+	}
+	for _, keyword := range assertions.BodyNotContains {
+		if bytes.Contains(body, []byte(keyword)) {
+			failed = append(failed, fmt.Sprintf("body contains %q", keyword))
+		}
+	}
+	for _, expr := range assertions.BodyMatches {
+		re, err := regexp.Compile(expr)
+		if err != nil || !re.Match(body) {
+			failed = append(failed, fmt.Sprintf("body does not match /%s/", expr))
+		}
+	}
+	for _, expr := range assertions.BodyNotMatches {
+		re, err := regexp.Compile(expr)
+		if err != nil || re.Match(body) {
+			failed = append(failed, fmt.Sprintf("body matches /%s/", expr))
+		}
+	}
+	if len(assertions.JSONPath) > 0 {
+		failed = append(failed, evaluateJSONPaths(assertions.JSONPath, body)...)
+	}
+
+	if failure := responseTimeFailure(assertions, elapsed); failure != "" {
+		failed = append(failed, failure)
+	}
+	if assertions.MinCertDaysRemaining > 0 {
+		if tlsState == nil || len(tlsState.PeerCertificates) == 0 {
+			failed = append(failed, "no server certificate to check the days remaining of")
+		} else if left := certDaysRemaining(tlsState.PeerCertificates[0].NotAfter); left < assertions.MinCertDaysRemaining {
+			failed = append(failed, fmt.Sprintf("certificate expires in %d days, fewer than %d", left, assertions.MinCertDaysRemaining))
+		}
+	}
+	return failed
+}
+
+//evaluateJSONPaths checks each JSONPathAssertion against body decoded as JSON
+func evaluateJSONPaths(assertions []configuration.JSONPathAssertion, body []byte) []string {
+	failed := make([]string, 0)
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return append(failed, fmt.Sprintf("body is not JSON so json paths cannot be checked: %v", err))
+	}
+	for _, jp := range assertions {
+		path, err := jsonpath.Parse(jp.Path)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		value, ok := path.Lookup(doc)
+		if !ok {
+			failed = append(failed, fmt.Sprintf("json path %s not found", jp.Path))
+			continue
+		}
+		got, _ := json.Marshal(value)
+		want, _ := json.Marshal(jp.Equals)
+		if !bytes.Equal(got, want) {
+			failed = append(failed, fmt.Sprintf("json path %s is %s not %s", jp.Path, got, want))
+		}
+	}
+	return failed
+}
+
+//responseTimeFailure returns the failure of the MaxResponseTime assertion, or "" if it holds or is not set
+func responseTimeFailure(assertions *configuration.Assertions, elapsed time.Duration) string {
+	if assertions == nil {
+		return ""
+	}
+	if max := time.Duration(assertions.MaxResponseTime); max > 0 && elapsed > max {
+		return fmt.Sprintf("response time %dms exceeds %dms", elapsed.Milliseconds(), max.Milliseconds())
+	}
+	return ""
+}
+
+//certDaysRemaining returns the whole days left until notAfter
+func certDaysRemaining(notAfter time.Time) int {
+	return int(time.Until(notAfter).Hours() / 24)
+}
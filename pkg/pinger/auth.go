@@ -0,0 +1,115 @@
+package pinger
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//maxTLSClients is the most clients with their own TLS setup kept. Rotated certificates leave old clients behind so the cache is
+// emptied when it is full
+const maxTLSClients = 64
+
+//tlsClients are the clients made for pages with a client certificate or CA bundle, shared by the workers
+var tlsClients = struct {
+	mu      sync.Mutex
+	clients map[[sha256.Size]byte]*http.Client
+}{clients: make(map[[sha256.Size]byte]*http.Client)}
+
+//authorise adds the credentials of auth to req. Secrets are read on every request so a rotated secret is picked up
+func authorise(req *http.Request, auth *configuration.PageAuth) error {
+	if auth == nil {
+		return nil
+	}
+	for name, ref := range auth.Headers {
+		value, err := ref.Resolve()
+		if err != nil {
+			return fmt.Errorf("auth header %s: %v", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	switch {
+	case auth.Password != "":
+		password, err := auth.Password.Resolve()
+		if err != nil {
+			return fmt.Errorf("auth password: %v", err)
+		}
+		req.SetBasicAuth(auth.Username, password)
+	case auth.Bearer != "":
+		token, err := auth.Bearer.Resolve()
+		if err != nil {
+			return fmt.Errorf("auth bearer: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+//authClient returns client with the client certificate and CA bundle of auth, or client itself if auth has neither.
+//
+//Clients are cached by base client and PEM material so a page does not get a new transport on every run
+func authClient(client *http.Client, auth *configuration.PageAuth) (*http.Client, error) {
+	if !auth.HasTLS() {
+		return client, nil
+	}
+	var certPEM, keyPEM, caPEM string
+	var err error
+	if auth.ClientCert != "" {
+		if certPEM, err = auth.ClientCert.Resolve(); err != nil {
+			return nil, fmt.Errorf("auth client_cert: %v", err)
+		}
+		if keyPEM, err = auth.ClientKey.Resolve(); err != nil {
+			return nil, fmt.Errorf("auth client_key: %v", err)
+		}
+	}
+	if auth.CABundle != "" {
+		if caPEM, err = auth.CABundle.Resolve(); err != nil {
+			return nil, fmt.Errorf("auth ca_bundle: %v", err)
+		}
+	}
+	key := sha256.Sum256([]byte(fmt.Sprintf("%p\x00%s\x00%s\x00%s", client, certPEM, keyPEM, caPEM)))
+	tlsClients.mu.Lock()
+	defer tlsClients.mu.Unlock()
+	if cached, ok := tlsClients.clients[key]; ok {
+		return cached, nil
+	}
+
+	base, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("client transport %T cannot take a client certificate", client.Transport)
+	}
+	transport := base.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if certPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("auth client certificate: %v", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	if caPEM != "" {
+		//SystemCertPool returns a copy so the bundle is only trusted by this client
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM([]byte(caPEM)) {
+			return nil, fmt.Errorf("auth ca_bundle has no PEM certificates")
+		}
+		transport.TLSClientConfig.RootCAs = roots
+	}
+	out := *client
+	out.Transport = transport
+	if len(tlsClients.clients) >= maxTLSClients {
+		tlsClients.clients = make(map[[sha256.Size]byte]*http.Client)
+	}
+	tlsClients.clients[key] = &out
+	return &out, nil
+}
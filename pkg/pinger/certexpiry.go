@@ -0,0 +1,41 @@
+package pinger
+
+import (
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//certLedgerFile is the file in STATE_DIR the expiryLedger of certificates is kept in
+const certLedgerFile = "cert_expiry.json"
+
+//certExpiries returns a CertExpiry for the leaf certificate of ping if it has crossed one of thresholds that was not already sent
+// according to ledger, which is keyed by certificate fingerprint. thresholds are in days sorted most first as from Config.ExpiryThresholds.
+//
+//Intermediate and root certificates of the chain are left out as they are shared by many sites and renewed by their issuer
+func certExpiries(ledger *expiryLedger, ping configuration.PingResponse, thresholds []int, now time.Time) []configuration.CertExpiry {
+	out := make([]configuration.CertExpiry, 0)
+	for _, cert := range ping.Certificates {
+		validUntil, err := time.Parse(time.RFC3339, cert.ValidUntil)
+		if !cert.ConnVerified || cert.Fingerprint == "" || err != nil {
+			continue
+		}
+		days, crossed := ledger.cross(cert.Fingerprint, validUntil, thresholds, now)
+		if crossed == 0 {
+			continue
+		}
+		out = append(out, configuration.CertExpiry{
+			ServiceName:   ping.ServiceName,
+			CheckID:       ping.CheckID,
+			URL:           ping.URL,
+			Subject:       cert.Subject,
+			Issuer:        cert.Issuer,
+			Fingerprint:   cert.Fingerprint,
+			ValidUntil:    cert.ValidUntil,
+			DaysRemaining: days,
+			Threshold:     crossed,
+			Time:          now.Format(time.RFC3339),
+		})
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package pinger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"github.com/karlsburg87/statusSentry/pkg/selector"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxDiffLines = 2000     //maxDiffLines is the most lines of each side compared line by line. Longer content is diffed as a whole
+	maxDiffBytes = 4 * 1024 //maxDiffBytes limits the size of the diff of a ContentChange
+)
+
+//watchedContent returns the content of body watched by watch, one line for each line of text
+func watchedContent(watch *configuration.ContentWatch, body []byte) (string, error) {
+	content := string(body)
+	if watch.Selector != "" {
+		sel, err := selector.Parse(watch.Selector)
+		if err != nil {
+			return "", err
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		content = selector.Text(sel.Select(doc)...)
+	}
+	if watch.Regex != "" {
+		re, err := regexp.Compile(watch.Regex)
+		if err != nil {
+			return "", err
+		}
+		matches := make([]string, 0)
+		for _, match := range re.FindAllStringSubmatch(content, -1) {
+			if len(match) > 1 {
+				match = match[1:]
+			}
+			matches = append(matches, match[0])
+		}
+		content = strings.Join(matches, "\n")
+	}
+	for _, expr := range watch.Ignore {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return "", err
+		}
+		content = re.ReplaceAllString(content, "")
+	}
+	//whitespace and blank lines are not content
+	lines := make([]string, 0)
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//contentHash returns the hex SHA-256 of content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+//contentChange returns the ContentChange of ping from the content previously seen, and whether there was a change.
+// No change is reported for the first content seen
+func contentChange(previous, previousHash string, ping configuration.PingResponse) (configuration.ContentChange, bool) {
+	if previousHash == "" || ping.ContentHash == "" || previousHash == ping.ContentHash {
+		return configuration.ContentChange{}, false
+	}
+	return configuration.ContentChange{
+		ServiceName: ping.ServiceName,
+		CheckID:     ping.CheckID,
+		URL:         ping.URL,
+		OldHash:     previousHash,
+		NewHash:     ping.ContentHash,
+		Diff:        lineDiff(previous, ping.Content),
+		Time:        ping.TimeGo.Format(time.RFC3339),
+	}, true
+}
+
+//lineDiff returns the lines removed from old, prefixed "- ", and added in new, prefixed "+ ", in order, using the shortest
+// edit script of lines found by Myers' linear space algorithm. Cut short at maxDiffBytes
+func lineDiff(old, new string) string {
+	a, b := splitLines(old), splitLines(new)
+	var out strings.Builder
+	write := func(prefix, line string) {
+		if out.Len() < maxDiffBytes {
+			out.WriteString(prefix + line + "\n")
+		}
+	}
+	if len(a) > maxDiffLines || len(b) > maxDiffLines { //too long to compare line by line
+		for _, line := range a {
+			write("- ", line)
+		}
+		for _, line := range b {
+			write("+ ", line)
+		}
+		return truncateDiff(out.String())
+	}
+	diffLines(a, b, 0, len(a), 0, len(b), write)
+	return truncateDiff(out.String())
+}
+
+//diffLines writes the edit script from a[a0:a1] to b[b0:b1] by splitting it at its middle snake until one side is empty
+func diffLines(a, b []string, a0, a1, b0, b1 int, write func(prefix, line string)) {
+	//lines common to the start and end need no edits
+	for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+		a0, b0 = a0+1, b0+1
+	}
+	for a0 < a1 && b0 < b1 && a[a1-1] == b[b1-1] {
+		a1, b1 = a1-1, b1-1
+	}
+	switch {
+	case a0 == a1:
+		for _, line := range b[b0:b1] {
+			write("+ ", line)
+		}
+	case b0 == b1:
+		for _, line := range a[a0:a1] {
+			write("- ", line)
+		}
+	default:
+		x, y, u, v := middleSnake(a, b, a0, a1, b0, b1)
+		diffLines(a, b, a0, x, b0, y, write)
+		diffLines(a, b, u, a1, v, b1, write)
+	}
+}
+
+//middleSnake returns the start x, y and end u, v of the middle snake of a shortest edit script from a[a0:a1] to b[b0:b1],
+// searching forward from the start and backward from the end at once until the paths overlap.
+//
+//Both ranges must be non empty and differ at their first and last lines so the script has at least two edits and
+// each side of the snake is a smaller problem
+func middleSnake(a, b []string, a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n+m+1)/2 + 1
+	//forward[limit+k] is the furthest x reached on diagonal k = x - y from the start.
+	// backward[limit+k] is the same from the end with x and y counted back from a1 and b1
+	forward, backward := make([]int, 2*limit+2), make([]int, 2*limit+2)
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := forward[limit+k-1] + 1
+			if k == -d || (k != d && forward[limit+k-1] < forward[limit+k+1]) {
+				x = forward[limit+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[a0+x] == b[b0+y] {
+				x, y = x+1, y+1
+			}
+			forward[limit+k] = x
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && x+backward[limit+delta-k] >= n {
+				return a0 + startX, b0 + startY, a0 + x, b0 + y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			x := backward[limit+k-1] + 1
+			if k == -d || (k != d && backward[limit+k-1] < backward[limit+k+1]) {
+				x = backward[limit+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[a1-1-x] == b[b1-1-y] {
+				x, y = x+1, y+1
+			}
+			backward[limit+k] = x
+			if !odd && delta-k >= -d && delta-k <= d && x+forward[limit+delta-k] >= n {
+				return a1 - x, b1 - y, a1 - startX, b1 - startY
+			}
+		}
+	}
+	//the paths always meet by then but fall back to replacing every line
+	return a1, b0, a1, b0
+}
+
+//splitLines returns the lines of s, none for an empty s
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+//truncateDiff cuts diff to maxDiffBytes at the start of a character, marking that it was cut
+func truncateDiff(diff string) string {
+	if len(diff) <= maxDiffBytes {
+		return strings.TrimSuffix(diff, "\n")
+	}
+	cut := maxDiffBytes
+	for cut > 0 && !utf8.RuneStart(diff[cut]) {
+		cut--
+	}
+	return diff[:cut] + "\n..."
+}
@@ -0,0 +1,365 @@
+package pinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	domainLedgerFile           = "domain_expiry.json" //domainLedgerFile is the file in STATE_DIR the expiryLedger of domains is kept in
+	defaultRDAPBase            = "https://rdap.org"   //defaultRDAPBase redirects each domain to the RDAP server of its registry
+	defaultWhoisServer         = "whois.iana.org:43"  //defaultWhoisServer refers each domain to the WHOIS server of its registry
+	defaultDomainCheckInterval = 24 * time.Hour
+	domainLookupTimeout        = 30 * time.Second
+	maxWhoisBytes              = 1 << 20 //maxWhoisBytes limits how much of a WHOIS answer is read
+)
+
+//whoisExpiryFields are the WHOIS fields registries give the expiry date in, most specific first
+var whoisExpiryFields = []string{"registry expiry date", "registrar registration expiration date", "expiration date", "expiry date", "expiration time", "expires", "expire", "paid-till", "renewal date"}
+
+//whoisDateLayouts are the date formats WHOIS servers are known to use
+var whoisDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "02-Jan-2006", "2006.01.02", "2006/01/02", "02.01.2006", "02/01/2006"}
+
+//registration is the registration of a domain
+type registration struct {
+	Domain    string
+	Registrar string
+	Expires   time.Time
+	Source    string //Source is where the registration came from: rdap or whois
+}
+
+//domainChecker looks up when the domains of each Config expire and sends a DomainExpiry as each crosses a threshold
+type domainChecker struct {
+	rdapBase    string //rdapBase is the RDAP server queried as {rdapBase}/domain/{domain}
+	whoisServer string //whoisServer is the host:port of the WHOIS server asked if RDAP fails. Referrals are followed once
+	client      *http.Client
+	ledger      *expiryLedger
+	//refresh is how long a registration kept in the ledger is used before it is looked up again, so config
+	// reloads do not query registries afresh. Zero looks every domain up on every check
+	refresh time.Duration
+}
+
+//newDomainChecker returns a domainChecker using the RDAP_BASE_URL and WHOIS_SERVER env vars or their defaults,
+// looking each domain up at most once every refresh
+func newDomainChecker(ledger *expiryLedger, refresh time.Duration) *domainChecker {
+	checker := &domainChecker{
+		rdapBase:    strings.TrimSuffix(os.Getenv("RDAP_BASE_URL"), "/"),
+		whoisServer: os.Getenv("WHOIS_SERVER"),
+		client:      &http.Client{Timeout: domainLookupTimeout},
+		ledger:      ledger,
+		refresh:     refresh,
+	}
+	if checker.rdapBase == "" {
+		checker.rdapBase = defaultRDAPBase
+	}
+	if checker.whoisServer == "" {
+		checker.whoisServer = defaultWhoisServer
+	}
+	return checker
+}
+
+//domainCheckInterval returns how often domains are checked from the DOMAIN_CHECK_INTERVAL env var. Zero switches checks off
+func domainCheckInterval() time.Duration {
+	raw := os.Getenv("DOMAIN_CHECK_INTERVAL")
+	if raw == "" {
+		return defaultDomainCheckInterval
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("DOMAIN_CHECK_INTERVAL must be a Go duration string e.g. 24h, using %s: %v", defaultDomainCheckInterval, err)
+		return defaultDomainCheckInterval
+	}
+	return interval
+}
+
+//watchDomains checks the domains of the latest Configuration from configs when it arrives and then every interval until ctx is done.
+// Domains looked up within the refresh of the checker are not looked up again
+func watchDomains(ctx context.Context, configs <-chan *configuration.Configuration, sender chan<- configuration.Transporter, checker *domainChecker, interval time.Duration) {
+	var current *configuration.Configuration
+	tckr := time.NewTicker(interval)
+	defer tckr.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case current = <-configs:
+		case <-tckr.C:
+		}
+		if current != nil {
+			checker.check(ctx, current, sender, time.Now())
+		}
+	}
+}
+
+//check looks up the registration of the domains of every Config and sends a DomainExpiry for each that crossed a threshold not already sent
+func (checker *domainChecker) check(ctx context.Context, configs *configuration.Configuration, sender chan<- configuration.Transporter, now time.Time) {
+	//each domain is looked up once however many services share it
+	lookups := make(map[string]registration)
+	failed := make(map[string]bool)
+	changed := false
+	for _, config := range *configs {
+		for _, domain := range registeredDomains(config) {
+			reg, ok := lookups[domain]
+			if !ok {
+				if failed[domain] {
+					continue
+				}
+				if reg, ok = checker.recent(domain, now); !ok {
+					var err error
+					reg, err = checker.lookup(ctx, domain)
+					if err != nil {
+						log.Printf("could not look up the registration of domain %s of %s: %v", domain, config.ServiceName, err)
+						//remembered as failed so it is not retried until refresh either
+						reg = registration{Domain: domain}
+					}
+					checker.remember(reg, now)
+					changed = true
+				}
+				if reg.Source == "" {
+					failed[domain] = true
+					continue
+				}
+				lookups[domain] = reg
+			}
+			//keyed by expiry too so a renewed registration is followed afresh
+			days, crossed := checker.ledger.cross(domain+"@"+reg.Expires.UTC().Format(time.RFC3339), reg.Expires, config.DomainExpiryThresholds(), now)
+			if crossed == 0 {
+				continue
+			}
+			expiry := configuration.DomainExpiry{
+				ServiceName:   config.ServiceName,
+				Domain:        domain,
+				Registrar:     reg.Registrar,
+				ExpiresAt:     reg.Expires.Format(time.RFC3339),
+				DaysRemaining: days,
+				Threshold:     crossed,
+				Source:        reg.Source,
+				Time:          now.Format(time.RFC3339),
+			}
+			log.Println(expiry)
+			if err := expiry.Send(config, sender); err != nil {
+				log.Printf("error on DomainExpiry.Send for domain %s and error : %v", domain, err)
+			}
+			changed = true
+		}
+	}
+	if changed {
+		if err := checker.ledger.save(now); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+//registrationKey is the ledger key the last registration looked up for domain is kept under
+func registrationKey(domain string) string {
+	return "registration:" + domain
+}
+
+//recent returns the registration of domain kept in the ledger if it was looked up within refresh of now.
+// A lookup that failed has no Source
+func (checker *domainChecker) recent(domain string, now time.Time) (registration, bool) {
+	entry, ok := checker.ledger.entries[registrationKey(domain)]
+	if !ok || entry.Checked.IsZero() || now.Sub(entry.Checked) >= checker.refresh {
+		return registration{}, false
+	}
+	return registration{Domain: domain, Registrar: entry.Registrar, Expires: entry.ValidUntil, Source: entry.Source}, true
+}
+
+//remember keeps reg in the ledger as looked up at now
+func (checker *domainChecker) remember(reg registration, now time.Time) {
+	validUntil := reg.Expires
+	if reg.Source == "" { //failed lookups are kept as long as a recent expiry
+		validUntil = now
+	}
+	checker.ledger.entries[registrationKey(reg.Domain)] = expiryLedgerEntry{ValidUntil: validUntil, Checked: now, Registrar: reg.Registrar, Source: reg.Source}
+}
+
+//registeredDomains returns the registered domains, such as example.co.uk, of the hosts of config
+func registeredDomains(config configuration.Config) []string {
+	out := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, host := range config.Hosts() {
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		out = append(out, domain)
+	}
+	return out
+}
+
+//lookup returns the registration of domain from RDAP, or from WHOIS if RDAP fails
+func (checker *domainChecker) lookup(ctx context.Context, domain string) (registration, error) {
+	ctx, cancel := context.WithTimeout(ctx, domainLookupTimeout)
+	defer cancel()
+	reg, err := checker.rdap(ctx, domain)
+	if err == nil {
+		return reg, nil
+	}
+	reg, whoisErr := checker.whois(ctx, domain)
+	if whoisErr != nil {
+		return reg, fmt.Errorf("rdap: %v, whois: %v", err, whoisErr)
+	}
+	return reg, nil
+}
+
+//rdapDomain is the part of an RDAP domain response used
+type rdapDomain struct {
+	Events []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Entities []struct {
+		Roles []string          `json:"roles"`
+		VCard []json.RawMessage `json:"vcardArray"`
+	} `json:"entities"`
+}
+
+//rdap returns the registration of domain from the RDAP server
+func (checker *domainChecker) rdap(ctx context.Context, domain string) (registration, error) {
+	reg := registration{Domain: domain, Source: "rdap"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checker.rdapBase+"/domain/"+domain, nil)
+	if err != nil {
+		return reg, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	res, err := checker.client.Do(req)
+	if err != nil {
+		return reg, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return reg, fmt.Errorf("%s answered %s", req.URL, res.Status)
+	}
+	var body rdapDomain
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return reg, fmt.Errorf("could not parse RDAP response: %v", err)
+	}
+	for _, event := range body.Events {
+		if event.Action == "expiration" {
+			if reg.Expires, err = time.Parse(time.RFC3339, event.Date); err != nil {
+				return reg, fmt.Errorf("could not parse RDAP expiration date %q: %v", event.Date, err)
+			}
+		}
+	}
+	if reg.Expires.IsZero() {
+		return reg, fmt.Errorf("RDAP response has no expiration event")
+	}
+	for _, entity := range body.Entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" {
+				reg.Registrar = vcardName(entity.VCard)
+			}
+		}
+	}
+	return reg, nil
+}
+
+//vcardName returns the formatted name (fn) of an RDAP jCard such as ["vcard", [["fn", {}, "text", "Name"]]]
+func vcardName(vcard []json.RawMessage) string {
+	if len(vcard) < 2 {
+		return ""
+	}
+	var properties [][]interface{}
+	if err := json.Unmarshal(vcard[1], &properties); err != nil {
+		return ""
+	}
+	for _, property := range properties {
+		if len(property) >= 4 && property[0] == "fn" {
+			name, _ := property[3].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+//whois returns the registration of domain from the WHOIS server, following a referral to the server of its registry once
+func (checker *domainChecker) whois(ctx context.Context, domain string) (registration, error) {
+	reg := registration{Domain: domain, Source: "whois"}
+	fields, err := whoisQuery(ctx, checker.whoisServer, domain)
+	if err != nil {
+		return reg, err
+	}
+	if refer := fields["refer"]; refer != "" {
+		if _, _, err := net.SplitHostPort(refer); err != nil {
+			refer = net.JoinHostPort(refer, "43")
+		}
+		if fields, err = whoisQuery(ctx, refer, domain); err != nil {
+			return reg, err
+		}
+	}
+	for _, field := range whoisExpiryFields {
+		if value := fields[field]; value != "" {
+			if reg.Expires, err = parseWhoisDate(value); err != nil {
+				return reg, err
+			}
+			break
+		}
+	}
+	if reg.Expires.IsZero() {
+		return reg, fmt.Errorf("WHOIS response has no expiry date")
+	}
+	reg.Registrar = fields["registrar"]
+	return reg, nil
+}
+
+//whoisQuery asks the WHOIS server at address about domain and returns the first value of each field of the answer by lower case name
+func whoisQuery(ctx context.Context, address, domain string) (map[string]string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, domain+"\r\n"); err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(conn, maxWhoisBytes))
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(raw), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if !ok || value == "" || strings.HasPrefix(name, "%") || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if _, exists := fields[name]; !exists {
+			fields[name] = value
+		}
+	}
+	return fields, nil
+}
+
+//parseWhoisDate parses a WHOIS date in any of the whoisDateLayouts, with or without a trailing time zone name
+func parseWhoisDate(value string) (time.Time, error) {
+	candidates := []string{value}
+	if first := strings.Fields(value); len(first) > 1 {
+		candidates = append(candidates, first[0])
+	}
+	for _, candidate := range candidates {
+		for _, layout := range whoisDateLayouts {
+			if t, err := time.Parse(layout, candidate); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse WHOIS date %q", value)
+}
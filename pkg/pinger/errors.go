@@ -0,0 +1,65 @@
+package pinger
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//recordFailure marks out as failed by err, categorised by classifyError
+func recordFailure(out configuration.PingResponse, err error, fallback configuration.ErrorCategory) configuration.PingResponse {
+	out.Passed = false
+	out.ErrorCategory = classifyError(err, fallback)
+	out.ErrorText = err.Error()
+	var uerr *url.Error
+	if errors.As(err, &uerr) { //the method and URL are already in the PingResponse
+		out.ErrorText = uerr.Err.Error()
+	}
+	return out
+}
+
+//classifyError returns the ErrorCategory of err from a check, or fallback if it fits none
+func classifyError(err error, fallback configuration.ErrorCategory) configuration.ErrorCategory {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return configuration.ErrorDNS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return configuration.ErrorTimeout
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var recordHeader tls.RecordHeaderError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &recordHeader) {
+		return configuration.ErrorTLS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" { //TLS alerts from the server
+		return configuration.ErrorTLS
+	}
+	if strings.Contains(err.Error(), "tls: ") {
+		return configuration.ErrorTLS
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return configuration.ErrorReset
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		(opErr != nil && opErr.Op == "dial") {
+		return configuration.ErrorConnect
+	}
+	return fallback
+}
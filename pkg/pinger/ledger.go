@@ -0,0 +1,108 @@
+package pinger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//expiryLedgerKeep is how long after something expires its entry is kept in an expiryLedger
+const expiryLedgerKeep = 30 * 24 * time.Hour
+
+//expiryLedger records the expiry thresholds already sent for each expiring thing, such as a certificate by its fingerprint,
+// so each threshold is sent once even across restarts. Not safe for concurrent use
+type expiryLedger struct {
+	path    string                       //path is the file the ledger is saved to. Empty to keep it in memory only
+	entries map[string]expiryLedgerEntry //entries are keyed by what expires
+}
+
+//expiryLedgerEntry is the expiryLedger record of a single expiring thing
+type expiryLedgerEntry struct {
+	ValidUntil time.Time `json:"valid_until"`
+	Sent       []int     `json:"sent"` //Sent are the thresholds in days an event was sent for
+
+	//Checked, Registrar and Source are the lookup of a domain registration kept to save looking it up again
+	Checked   time.Time `json:"checked,omitempty"`
+	Registrar string    `json:"registrar,omitempty"`
+	Source    string    `json:"source,omitempty"`
+}
+
+//loadExpiryLedger loads the expiryLedger kept in file of dir. An empty dir keeps the ledger in memory only
+func loadExpiryLedger(dir, file string) (*expiryLedger, error) {
+	ledger := &expiryLedger{entries: make(map[string]expiryLedgerEntry)}
+	if dir == "" {
+		return ledger, nil
+	}
+	ledger.path = filepath.Join(dir, file)
+	raw, err := os.ReadFile(ledger.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return ledger, fmt.Errorf("could not read expiry ledger %s: %v", ledger.path, err)
+	}
+	if err := json.Unmarshal(raw, &ledger.entries); err != nil {
+		return ledger, fmt.Errorf("could not parse expiry ledger %s: %v", ledger.path, err)
+	}
+	return ledger, nil
+}
+
+//save writes the ledger to its file, dropping entries long expired
+func (ledger *expiryLedger) save(now time.Time) error {
+	if ledger.path == "" {
+		return nil
+	}
+	for key, entry := range ledger.entries {
+		if now.Sub(entry.ValidUntil) > expiryLedgerKeep {
+			delete(ledger.entries, key)
+		}
+	}
+	raw, err := json.Marshal(ledger.entries)
+	if err != nil {
+		return err
+	}
+	//write to a temporary file first so a crash never leaves a partial ledger
+	tmp := ledger.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("could not write expiry ledger %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, ledger.path); err != nil {
+		return fmt.Errorf("could not replace expiry ledger %s: %v", ledger.path, err)
+	}
+	return nil
+}
+
+//cross returns the whole days from now until key expires at validUntil and the nearest of thresholds it has crossed that was not
+// already sent, or zero if there is none. A threshold is crossed once no more than its days remain. thresholds are in days sorted most first.
+//
+//Something past several unsent thresholds is sent once for the nearest so every one of them is marked as sent
+func (ledger *expiryLedger) cross(key string, validUntil time.Time, thresholds []int, now time.Time) (days, threshold int) {
+	//whole days rounded down so something that expired an hour ago has -1 days remaining
+	days = int(math.Floor(validUntil.Sub(now).Hours() / 24))
+	entry := ledger.entries[key]
+	entry.ValidUntil = validUntil
+	for _, limit := range thresholds {
+		if days <= limit && !contains(entry.Sent, limit) {
+			entry.Sent = append(entry.Sent, limit)
+			threshold = limit
+		}
+	}
+	if threshold != 0 {
+		ledger.entries[key] = entry
+	}
+	return days, threshold
+}
+
+//contains reports whether value is in values
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
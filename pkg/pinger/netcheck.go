@@ -0,0 +1,258 @@
+package pinger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//networkCheck runs a check that has no HTTP request, recording its timings and addresses into res.
+//
+//Returns the expectations of the check that were not met, or an error if the check could not be run
+type networkCheck func(ctx context.Context, page configuration.PollPage, res *configuration.PingResponse) ([]string, error)
+
+//networkChecks are the networkCheck to run for each non HTTP CheckType
+var networkChecks = map[configuration.CheckType]networkCheck{
+	configuration.CheckTCP:  checkTCP,
+	configuration.CheckDNS:  checkDNS,
+	configuration.CheckEcho: checkEcho,
+}
+
+//defaultNetworkTimeout is the timeout of a networkCheck for a page without its own Timeout
+const defaultNetworkTimeout = 30 * time.Second
+
+//pollNetwork runs the networkCheck for page and returns its PingResponse
+func pollNetwork(page pageParcel, run networkCheck) configuration.PingResponse {
+	timeout := defaultNetworkTimeout
+	if page.page.Timeout > 0 {
+		timeout = time.Duration(page.page.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tme := time.Now()
+	res := configuration.PingResponse{
+		StatusPage:   page.config.StatusPage,
+		ServiceName:  page.config.ServiceName,
+		Domain:       page.config.DisplayDomain,
+		CheckID:      page.page.CheckID(page.config.ServiceName),
+		Tags:         page.page.Tags,
+		URL:          page.page.URL,
+		Time:         tme.Format(time.RFC3339),
+		TimeGo:       tme,
+		Certificates: make([]configuration.PingCert, 0),
+		CheckType:    page.page.CheckType(),
+	}
+	failed, err := run(ctx, page.page, &res)
+	if err != nil {
+		res = recordFailure(res, err, configuration.ErrorConnect)
+	}
+	elapsed := time.Since(tme)
+	res.ResponseTimes.Total = elapsed.Milliseconds()
+	if failure := responseTimeFailure(page.page.Assertions, elapsed); failure != "" {
+		failed = append(failed, failure)
+	}
+	res.FailedAssertions = failed
+	res.Passed = err == nil && len(failed) == 0
+	return res
+}
+
+//checkTCP connects to the tcp://host:port of page timing the lookup and the connection
+func checkTCP(ctx context.Context, page configuration.PollPage, res *configuration.PingResponse) ([]string, error) {
+	address, err := page.TCPAddress()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTimed(ctx, "tcp", address, res)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	return nil, nil
+}
+
+//checkEcho sends a payload to the echo://host:port of page and checks the same payload comes back
+func checkEcho(ctx context.Context, page configuration.PollPage, res *configuration.PingResponse) ([]string, error) {
+	network, address, err := page.EchoTarget()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTimed(ctx, network, address, res)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	payload := []byte(fmt.Sprintf("statusSentry echo %d", time.Now().UnixNano()))
+	start := time.Now()
+	if _, err := conn.Write(payload); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, len(payload))
+	if network == "udp" { //a datagram comes back whole
+		var n int
+		n, err = conn.Read(reply)
+		reply = reply[:n]
+	} else {
+		_, err = io.ReadFull(conn, reply)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.ResponseTimes.RoundTrip = time.Since(start).Milliseconds()
+	if !bytes.Equal(reply, payload) {
+		return []string{fmt.Sprintf("echo reply %q does not match the payload sent", reply)}, nil
+	}
+	return nil, nil
+}
+
+//dialTimed resolves the host of address then connects to each address found in turn until one connects,
+// timing both into res. The error of the last address tried is returned if none connect. See dialEach
+func dialTimed(ctx context.Context, network, address string, res *configuration.PingResponse) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+		res.ResponseTimes.DNS = time.Since(start).Milliseconds()
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.ResolvedAddresses = addrs
+	return dialEach(ctx, network, addrs, port, res)
+}
+
+//dialEach connects to port of each of addrs in turn until one connects, timing the connection into res
+func dialEach(ctx context.Context, network string, addrs []string, port string, res *configuration.PingResponse) (net.Conn, error) {
+	res.ResponseTimes.Protocol = network
+	var dialer net.Dialer
+	err := fmt.Errorf("no addresses to connect to")
+	for i, addr := range addrs {
+		//as net.Dialer does, give each address an equal share of the time left so a dead first address cannot use it all
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			share := time.Until(deadline) / time.Duration(len(addrs)-i)
+			if share < minDialShare {
+				share = minDialShare
+			}
+			attemptCtx, cancel = context.WithTimeout(ctx, share)
+		}
+		start := time.Now()
+		conn, dialErr := dialer.DialContext(attemptCtx, network, net.JoinHostPort(addr, port))
+		cancel()
+		res.ResponseTimes.Connect = time.Since(start).Milliseconds()
+		res.ResponseTimes.RemoteIP = addr
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = dialErr
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+//minDialShare is the least time given to connect to each address of a host, as used by net.Dialer
+const minDialShare = 2 * time.Second
+
+//checkDNS resolves the dns:// query of page and checks every expected value is in the answer
+func checkDNS(ctx context.Context, page configuration.PollPage, res *configuration.PingResponse) ([]string, error) {
+	query, err := page.DNSQuery()
+	if err != nil {
+		return nil, err
+	}
+	resolver := net.DefaultResolver
+	if query.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, query.Server)
+			},
+		}
+	}
+
+	start := time.Now()
+	answers, err := lookup(ctx, resolver, query)
+	res.ResponseTimes.DNS = time.Since(start).Milliseconds()
+	if err != nil {
+		return nil, err
+	}
+	res.ResolvedAddresses = answers
+
+	failed := make([]string, 0)
+	found := make(map[string]bool)
+	for _, answer := range answers {
+		found[normaliseAnswer(query.Type, answer)] = true
+	}
+	for _, expected := range query.Expect {
+		if !found[normaliseAnswer(query.Type, expected)] {
+			failed = append(failed, fmt.Sprintf("%s records of %s do not include %q", query.Type, query.Name, expected))
+		}
+	}
+	return failed, nil
+}
+
+//lookup returns the answers for query from resolver as strings
+func lookup(ctx context.Context, resolver *net.Resolver, query configuration.DNSQuery) ([]string, error) {
+	out := make([]string, 0)
+	switch query.Type {
+	case "A", "AAAA":
+		network := "ip4"
+		if query.Type == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, query.Name)
+		for _, ip := range ips {
+			out = append(out, ip.String())
+		}
+		return out, err
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, query.Name)
+		if cname != "" {
+			out = append(out, cname)
+		}
+		return out, err
+	case "MX":
+		records, err := resolver.LookupMX(ctx, query.Name)
+		for _, mx := range records {
+			out = append(out, mx.Host)
+		}
+		return out, err
+	case "NS":
+		records, err := resolver.LookupNS(ctx, query.Name)
+		for _, ns := range records {
+			out = append(out, ns.Host)
+		}
+		return out, err
+	case "TXT":
+		return resolver.LookupTXT(ctx, query.Name)
+	}
+	return out, fmt.Errorf("unsupported record type %q", query.Type)
+}
+
+//normaliseAnswer puts IP addresses in their canonical form and lower cases names without the trailing dot so answers compare.
+// TXT records are compared as is
+func normaliseAnswer(recordType, answer string) string {
+	if recordType == "TXT" {
+		return answer
+	}
+	if ip := net.ParseIP(answer); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(strings.TrimSuffix(answer, "."))
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptrace"
-	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/karlsburg87/statusSentry/pkg/configuration"
@@ -20,171 +22,364 @@ func Launch(ctx context.Context, conf <-chan *configuration.Configuration) {
 	go Ping(ctx, conf)
 }
 
-//Ping is the goroutine responsible for webpage uptime polling
+//Ping is the goroutine responsible for webpage uptime polling.
+//
+//Each page is run on its own frequency with jitter by a scheduler and dispatched to a bounded pool of POLL_WORKERS workers
+// so a slow page does not hold up the others
 func Ping(ctx context.Context, conf <-chan *configuration.Configuration) {
-	//logbook records the URL string that has been called against the call time so frequency can be respected
-	logbook := make(map[string]time.Time)
+	//schedule holds the scheduling state of every page to poll and is kept across config reloads
+	schedule := newScheduler()
 	//initial configs
 	configs := <-conf
+	schedule.apply(nil, configs, time.Now())
 	//spin up sender that sends to pubsub and other services
 	sender := make(chan configuration.Transporter)
 	go dispatch.Sender(os.Getenv("OUTBOUND_URL"), sender)
-	//spin up poller which does the ping and collects the data
-	pinger := make(chan *configuration.Configuration)
-	go ping(pinger, logbook, sender)
+	//certificate expiry events already sent are kept in STATE_DIR so they are not sent again after a restart
+	ledger, err := loadExpiryLedger(os.Getenv("STATE_DIR"), certLedgerFile)
+	if err != nil {
+		log.Printf("starting with an empty certificate expiry ledger: %v", err)
+	}
+	//domain registrations are checked on their own goroutine as lookups are slow and rare. Given the latest config only
+	domainConfigs := make(chan *configuration.Configuration, 1)
+	if interval := domainCheckInterval(); interval > 0 {
+		domainLedger, err := loadExpiryLedger(os.Getenv("STATE_DIR"), domainLedgerFile)
+		if err != nil {
+			log.Printf("starting with an empty domain expiry ledger: %v", err)
+		}
+		go watchDomains(ctx, domainConfigs, sender, newDomainChecker(domainLedger, interval/2), interval)
+	}
+	offerConfig(domainConfigs, configs)
+	//spin up the worker pool which does the ping and collects the data
+	workers := pollWorkers()
+	jobs := make(chan pageParcel)
+	finished := make(chan finishedRun, workers)
+	httpClient := newClient()
+	for i := 0; i < workers; i += 1 {
+		go work(jobs, finished, &httpClient)
+	}
+	log.Printf("ping worker pool of %d ready to receive\n", workers)
 
 	//control pace
-	tckr := time.NewTicker(15 * time.Second)
+	timer := time.NewTimer(schedule.wait(time.Now()))
+	defer timer.Stop()
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(schedule.wait(time.Now()))
+	}
 
 	for {
 		select {
-		case config := <-conf: //update config list
+		case config := <-conf: //update config list keeping the state of unchanged checks
+			diff := schedule.apply(configs, config, time.Now())
 			configs = config
+			offerConfig(domainConfigs, config)
+			log.Printf("pinger config updated: %s", diff)
+			resetTimer()
 		case <-ctx.Done():
 			return
-		case <-tckr.C:
-			pinger <- configs
+		case now := <-timer.C:
+			schedule.dispatch(now, jobs)
+			timer.Reset(schedule.wait(time.Now()))
+		case run := <-finished:
+			report(run, schedule.finish(run.parcel.key), ledger, sender)
 		}
 	}
 }
 
-//ping sends a get request to each poll url in the configuration.Configuration
-// and records to logbook and sends a Transport for each
-func ping(config <-chan *configuration.Configuration, logbook map[string]time.Time, sender chan<- configuration.Transporter) {
-	httpClient := newClient()
-	//start polling worker pool
-	pageChan := make(chan pageParcel)
-	for i := 0; i < 20; i += 1 {
-		go poll(pageChan, &httpClient)
+//offerConfig replaces any Configuration waiting in the single slot buffered latest with config without blocking.
+// Only one goroutine may send to latest
+func offerConfig(latest chan *configuration.Configuration, config *configuration.Configuration) {
+	select {
+	case <-latest:
+	default:
 	}
+	latest <- config
+}
+
+//defaultPollWorkers is the size of the worker pool if POLL_WORKERS is not set
+const defaultPollWorkers = 20
 
-	log.Printf("ping worker pool ready to receive\n")
+//pollWorkers returns the size of the worker pool from the POLL_WORKERS env var
+func pollWorkers() int {
+	workers, err := strconv.Atoi(os.Getenv("POLL_WORKERS"))
+	if err != nil || workers <= 0 {
+		return defaultPollWorkers
+	}
+	return workers
+}
 
-	for conf := range config {
-		for _, item := range *conf {
-			//test if it is time to poll this config item
-			if !item.IsReadyToPoll() {
-				continue
+//finishedRun is a run of a check returned by a worker
+type finishedRun struct {
+	parcel   pageParcel
+	response configuration.PingResponse
+	change   *configuration.ContentChange //change is the change of watched content since the previous run. Nil if there was none
+}
+
+//work runs each check from jobs and returns the result on finished
+func work(jobs <-chan pageParcel, finished chan<- finishedRun, client *http.Client) {
+	for page := range jobs {
+		finished <- finishRun(page, runCheck(page, client))
+	}
+}
+
+//finishRun returns the finishedRun of parcel with its response. The content diff is worked out here on the worker
+// as it can be slow for long pages and must not hold up the scheduling loop
+func finishRun(parcel pageParcel, response configuration.PingResponse) finishedRun {
+	run := finishedRun{parcel: parcel, response: response}
+	if change, changed := contentChange(parcel.content, parcel.contentHash, response); changed {
+		run.change = &change
+	}
+	return run
+}
+
+//report sends the PingResponse of run with its schedule drift and skipped runs, then a CertExpiry for each certificate crossing an
+// expiry threshold and a StateChange if the state of the page moved on.
+// c is the scheduled check of the run, nil if it was removed while it ran
+func report(run finishedRun, c *check, ledger *expiryLedger, sender chan<- configuration.Transporter) {
+	pingDetails := run.response
+	pingDetails.ScheduleDrift = run.parcel.drift.Milliseconds()
+	pingDetails.SkippedRuns = run.parcel.skipped
+	if err := pingDetails.Send(run.parcel.config, sender); err != nil {
+		log.Printf("error on PingResponse.Send for URL %s and error : %v", run.parcel.page.URL, err)
+	}
+	now := time.Now()
+	if expiries := certExpiries(ledger, pingDetails, run.parcel.config.ExpiryThresholds(), now); len(expiries) > 0 {
+		for _, expiry := range expiries {
+			log.Println(expiry)
+			if err := expiry.Send(run.parcel.config, sender); err != nil {
+				log.Printf("error on CertExpiry.Send for URL %s and error : %v", run.parcel.page.URL, err)
 			}
-			for _, page := range item.PollPages {
-				//---fmt.Printf("pinging %s\n", page)
-				//test the response of the page
-				goPoll := pageParcel{
-					url:          page,
-					responseData: make(chan configuration.PingResponse),
-					config:       item,
-				}
-				pageChan <- goPoll
-				//send off data for that page
-				pingDetails := <-goPoll.responseData
-				//---fmt.Printf("ping response: %+v\n", pingDetails)
-				if err := pingDetails.Send(item, sender); err != nil {
-					log.Printf("error on PingResponse.Send for URL %s and error : %v", page, err)
-				}
-				item.SetFetchTime(pingDetails.TimeGo)
+		}
+		if err := ledger.save(now); err != nil {
+			log.Println(err)
+		}
+	}
+	if c == nil {
+		return
+	}
+	//send a content change when the watched content differs from the last response
+	if pingDetails.ContentHash != "" {
+		if run.change != nil {
+			log.Println(*run.change)
+			if err := run.change.Send(run.parcel.config, sender); err != nil {
+				log.Printf("error on ContentChange.Send for URL %s and error : %v", run.parcel.page.URL, err)
 			}
 		}
+		c.content, c.contentHash = pingDetails.Content, pingDetails.ContentHash
+	}
+	//send a state change only when the state of the page moves on
+	var policy configuration.StatePolicy
+	if run.parcel.page.State != nil {
+		policy = *run.parcel.page.State
+	}
+	if change, changed := c.tracker.observe(pingDetails, policy); changed {
+		log.Println(change)
+		if err := change.Send(run.parcel.config, sender); err != nil {
+			log.Printf("error on StateChange.Send for URL %s and error : %v", run.parcel.page.URL, err)
+		}
 	}
 }
 
 //pageParcel is for communication between ping writer func and poll receiver goroutines
 type pageParcel struct {
-	url          string
+	page         configuration.PollPage
 	responseData chan configuration.PingResponse
 	config       configuration.Config
+
+	key     checkKey      //key is the scheduled check the parcel is a run of
+	drift   time.Duration //drift is how late the run was dispatched after it was due
+	skipped int           //skipped is the number of runs of the check missed since its last run
+
+	content     string //content is the watched content of the previous run of the check to diff against
+	contentHash string //contentHash is the hash of content. Empty before the content is first seen
 }
 
 //poll runs the ping polling of the URL page with trace and returns through the pageParcel response chan
 func poll(pageChan <-chan pageParcel, client *http.Client) error {
-	//tracing variables
-	var start, dns, tlsHandshake, connect time.Time
-	var toFirstResponseDuration, dnsDuration, tlsHandshakeDuration, connectDuration time.Duration
-
-	trace := &httptrace.ClientTrace{
-		WroteRequest: func(wri httptrace.WroteRequestInfo) { start = time.Now() },
-		DNSStart:     func(dsi httptrace.DNSStartInfo) { dns = time.Now() },
-		DNSDone: func(ddi httptrace.DNSDoneInfo) {
-			dnsDuration = time.Since(dns)
-		},
-
-		TLSHandshakeStart: func() { tlsHandshake = time.Now() },
-		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
-			tlsHandshakeDuration = time.Since(tlsHandshake)
-		},
-
-		ConnectStart: func(network, addr string) { connect = time.Now() },
-		ConnectDone: func(network, addr string, err error) {
-			connectDuration = time.Since(connect)
-		},
-
-		GotFirstResponseByte: func() {
-			toFirstResponseDuration = time.Since(start)
-		},
-	}
 	for page := range pageChan {
-		req, err := http.NewRequest(http.MethodGet, page.url, nil)
-		if err != nil {
-			log.Printf("error making new request for polling URL %s", page.url)
-			log.Panicln(err)
+		page.responseData <- runCheck(page, client)
+	}
+	return nil
+}
+
+//runCheck runs the check of page of any CheckType, confirming failures with its retries
+func runCheck(page pageParcel, client *http.Client) configuration.PingResponse {
+	return confirm(page, func(page pageParcel) configuration.PingResponse {
+		if run, ok := networkChecks[page.page.CheckType()]; ok { //tcp, dns and echo checks have no HTTP request
+			return pollNetwork(page, run)
 		}
-		//add in the trace
-		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
-
-		//if just measuring if there was a response at all without caring for status
-		//code or dealing with redirects,etc (like ping command line program)
-		/*if _, err := http.DefaultTransport.RoundTrip(req); err != nil {
-			log.Fatal(err)
-		}*/
-		var issues string
-		res, err := client.Do(req)
-		if err != nil {
-			log.Printf("error on client.Do for polling URL %s", page.url)
-			var toe *url.Error
-			if errors.As(err, &toe) {
-				if toe.Timeout() || toe.Temporary() { //timeout and temporary connection errors should be recorded
-					issues = toe.Err.Error()
-				} else {
-					log.Panicln(err)
-				}
-			}
+		if page.page.CheckType() == configuration.CheckSynthetic {
+			return pollSynthetic(page, client)
 		}
-		//get TLS cert info
-		certs := make([]configuration.PingCert, 0)
-		for i, leaf := range res.TLS.PeerCertificates {
-			certificate := configuration.PingCert{
-				ConnVerified: i == 0,
-				Issuer:       leaf.Issuer.CommonName,
-				Subject:      leaf.Subject.CommonName,
-				ValidFrom:    leaf.NotBefore.Format(time.RFC3339),
-				ValidUntil:   leaf.NotAfter.Format(time.RFC3339),
-				IsExpired:    time.Now().After(leaf.NotAfter),
-			}
-			certs = append(certs, certificate)
+		return pollHTTP(page, client)
+	})
+}
+
+//confirm runs the check of page and, while it fails, retries it up to PollPage.Retries times after PollPage.RetryWait
+// so a transient blip is not reported as a failure.
+//
+//Returns the last attempt timed from the first, with every attempt in Attempts if the check was retried
+func confirm(page pageParcel, run func(pageParcel) configuration.PingResponse) configuration.PingResponse {
+	first := run(page)
+	res := first
+	attempts := []configuration.PingAttempt{first.Attempt()}
+	for i := 0; i < page.page.Retries && !res.Passed; i++ {
+		time.Sleep(page.page.RetryWait())
+		res = run(page)
+		attempts = append(attempts, res.Attempt())
+	}
+	if len(attempts) > 1 {
+		res.Attempts = attempts
+		res.Time, res.TimeGo = first.Time, first.TimeGo
+	}
+	return res
+}
+
+//pollHTTP runs the HTTP check of page once. Failures are recorded in the PingResponse
+func pollHTTP(page pageParcel, client *http.Client) configuration.PingResponse {
+	ctx, cancel := context.WithCancel(context.Background())
+	if page.page.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(page.page.Timeout))
+	}
+	//get ready to record result
+	tme := time.Now()
+	out := configuration.PingResponse{
+		StatusPage:   page.config.StatusPage,
+		ServiceName:  page.config.ServiceName,
+		Domain:       page.config.DisplayDomain,
+		CheckID:      page.page.CheckID(page.config.ServiceName),
+		Tags:         page.page.Tags,
+		URL:          page.page.URL,
+		Method:       page.page.HTTPMethod(),
+		Time:         tme.Format(time.RFC3339),
+		TimeGo:       tme,
+		Certificates: make([]configuration.PingCert, 0),
+		CheckType:    configuration.CheckHTTP,
+	}
+	req, err := newPageRequest(ctx, page.page)
+	if err != nil {
+		cancel()
+		log.Printf("error making new request for polling URL %s: %v", page.page.URL, err)
+		return recordFailure(out, err, configuration.ErrorHTTP)
+	}
+	client, err = authClient(client, page.page.Auth)
+	if err != nil {
+		cancel()
+		log.Printf("error setting up the client certificate for polling URL %s: %v", page.page.URL, err)
+		return recordFailure(out, err, configuration.ErrorTLS)
+	}
+	//add in a trace of this request alone
+	trace := newRequestTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	//if just measuring if there was a response at all without caring for status
+	//code or dealing with redirects,etc (like ping command line program)
+	/*if _, err := http.DefaultTransport.RoundTrip(req); err != nil {
+		log.Fatal(err)
+	}*/
+	res, err := client.Do(req)
+	if err != nil { //dead sites are recorded as failed pings rather than stopping the poller
+		cancel()
+		log.Printf("error on client.Do for polling URL %s: %v", page.page.URL, err)
+		out.ResponseTimes = trace.times(time.Now(), "")
+		out = recordFailure(out, err, configuration.ErrorHTTP)
+		if out.ErrorCategory == configuration.ErrorTLS { //inspect the certificate the handshake failed on
+			out.Certificates, out.TLS, out.Warnings = inspectFailedTLS(err, req.URL, clientRoots(client))
 		}
+		return out
+	}
+	out.StatusCode = res.StatusCode
+	//get TLS cert info. Plain http pages have none
+	out.Certificates = pingCerts(res.TLS)
+	out.TLS, out.Warnings = inspectTLS(res.TLS, res.Request.URL.Hostname(), clientRoots(client), time.Now())
 
-		//get ready to record result
-		tme := time.Now()
-		page.responseData <- configuration.PingResponse{
-			StatusPage:  page.config.StatusPage,
-			ServiceName: page.config.ServiceName,
-			Domain:      page.config.DisplayDomain,
-			URL:         page.url,
-			StatusCode:  res.StatusCode,
-			Time:        tme.Format(time.RFC3339),
-			TimeGo:      tme,
-			ResponseTimes: configuration.PingTimes{
-				DNS:           dnsDuration.Milliseconds(),
-				TLSHandshake:  tlsHandshakeDuration.Milliseconds(),
-				Connect:       connectDuration.Milliseconds(),
-				FirstResponse: toFirstResponseDuration.Milliseconds(),
-			},
-			Certificates: certs,
-			ErrorText:    issues,
+	//read the body for any assertions on it, or drain it, so the whole response is timed then release the request
+	var body []byte
+	if page.page.Assertions.HasBodyRules() || page.page.Content != nil {
+		body, err = io.ReadAll(io.LimitReader(res.Body, maxBodyBytes))
+	} else {
+		_, err = io.Copy(io.Discard, res.Body)
+	}
+	res.Body.Close()
+	cancel()
+	end := time.Now()
+	out.ResponseTimes = trace.times(end, res.Proto)
+	elapsed := end.Sub(trace.start)
+	if err != nil { //the connection failed part way through the body
+		log.Printf("error reading body of polling URL %s: %v", page.page.URL, err)
+		return recordFailure(out, err, configuration.ErrorHTTP)
+	}
+
+	out.FailedAssertions = evaluateAssertions(page.page, res.StatusCode, body, elapsed, res.TLS)
+	out.Passed = len(out.FailedAssertions) == 0
+	if !page.page.IsExpectedStatus(res.StatusCode) {
+		out.ErrorCategory = configuration.ErrorHTTP
+		out.ErrorText = res.Status
+		return out
+	}
+	//error pages are not the content being watched
+	if page.page.Content != nil {
+		content, err := watchedContent(page.page.Content, body)
+		if err != nil {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("could not read watched content: %v", err))
+			return out
 		}
+		out.Content, out.ContentHash = content, contentHash(content)
+	}
+	return out
+}
 
-		//Add info on
+//pingCerts returns the certificate info of the server certificates of a TLS connection. Empty if state is nil
+func pingCerts(state *tls.ConnectionState) []configuration.PingCert {
+	certs := make([]configuration.PingCert, 0)
+	if state == nil {
+		return certs
 	}
-	return nil
+	for i, leaf := range state.PeerCertificates {
+		certificate := configuration.PingCert{
+			ConnVerified: i == 0,
+			Issuer:       leaf.Issuer.CommonName,
+			Subject:      leaf.Subject.CommonName,
+			ValidFrom:    leaf.NotBefore.Format(time.RFC3339),
+			ValidUntil:   leaf.NotAfter.Format(time.RFC3339),
+			IsExpired:    time.Now().After(leaf.NotAfter),
+
+			SignatureAlgorithm: leaf.SignatureAlgorithm.String(),
+			DNSNames:           leaf.DNSNames,
+			Fingerprint:        certFingerprint(leaf),
+		}
+		certificate.KeyAlgorithm, certificate.KeyBits = certKey(leaf)
+		certs = append(certs, certificate)
+	}
+	return certs
+}
+
+//newPageRequest builds the check request for page with its method, headers, body and credentials
+func newPageRequest(ctx context.Context, page configuration.PollPage) (*http.Request, error) {
+	var body io.Reader
+	if page.Body != "" {
+		body = strings.NewReader(page.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, page.HTTPMethod(), page.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range page.Headers {
+		req.Header.Set(name, value)
+	}
+	if err := authorise(req, page.Auth); err != nil {
+		return nil, err
+	}
+	if host := req.Header.Get("Host"); host != "" { //Go sends req.Host rather than a Host header
+		req.Host = host
+	}
+	return req, nil
 }
 
 //NewPingHTTPHandler returns an http handler function that reuses a single poll goroutine and http client
@@ -213,13 +408,14 @@ func NewPingHTTPHandler() func(w http.ResponseWriter, r *http.Request) {
 		}
 		//send page url to poller
 		rtnChan := make(chan configuration.PingResponse)
+		page := configuration.PollPage{URL: pageURL}
 		pageChan <- pageParcel{
-			url:          pageURL,
+			page:         page,
 			responseData: rtnChan,
 			config: configuration.Config{
 				ServiceName:   "Requested site",
 				DisplayDomain: pageURL,
-				PollPages:     []string{pageURL},
+				PollPages:     []configuration.PollPage{page},
 				PollFrequency: configuration.Frequency(15 * time.Minute),
 			},
 		}
@@ -0,0 +1,1085 @@
+package pinger
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestApplyConfigKeepsSchedule(t *testing.T) {
+	schedule := newScheduler()
+	old := &configuration.Configuration{
+		{ServiceName: "Stripe", PollFrequency: configuration.Frequency(time.Minute), PollPages: []configuration.PollPage{{URL: "https://www.stripe.com"}, {URL: "https://api.stripe.com"}}},
+		{ServiceName: "Paypal", PollFrequency: configuration.Frequency(time.Minute), PollPages: []configuration.PollPage{{URL: "https://www.paypal.com"}}},
+	}
+	now := time.Now()
+	schedule.apply(nil, old, now)
+	jobs := make(chan pageParcel, 10)
+	//new checks are due within their jitter of a tenth of their frequency
+	if dispatched := schedule.dispatch(now.Add(6*time.Second), jobs); dispatched != 3 {
+		t.Fatalf("expected all 3 new checks to be due, got %d", dispatched)
+	}
+	for i := 0; i < 3; i++ {
+		run := <-jobs
+		schedule.finish(run.key)
+	}
+
+	new := &configuration.Configuration{
+		{ServiceName: "Stripe", PollFrequency: configuration.Frequency(time.Minute), PollPages: []configuration.PollPage{{URL: "https://www.stripe.com"}, {URL: "https://dashboard.stripe.com"}}},
+	}
+	diff := schedule.apply(old, new, now.Add(10*time.Second))
+	if len(diff.Removed) != 1 || len(diff.Changed) != 1 {
+		t.Errorf("unexpected diff %s", diff)
+	}
+	if len(schedule.checks) != 2 || len(schedule.queue) != 2 {
+		t.Fatalf("expected removed service and page checks to be dropped, got %d checks", len(schedule.checks))
+	}
+	kept := schedule.checks[checkKey{serviceName: "Stripe", page: "https://www.stripe.com"}]
+	if kept == nil || !kept.base.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected the unchanged check to keep its schedule, got %+v", kept)
+	}
+	schedule.dispatch(now.Add(20*time.Second), jobs)
+	if len(jobs) != 1 {
+		t.Fatalf("expected only the added page to be due, got %d", len(jobs))
+	}
+	if run := <-jobs; run.page.URL != "https://dashboard.stripe.com" {
+		t.Errorf("expected only the added page to be due, got %+v", run)
+	}
+}
+
+func TestSchedulerSkipsRunsWhenBusy(t *testing.T) {
+	schedule := newScheduler()
+	configs := &configuration.Configuration{
+		{ServiceName: "Fast", PollFrequency: configuration.Frequency(10 * time.Second), PollPages: []configuration.PollPage{{URL: "https://fast.example.com"}}},
+		{ServiceName: "Slow", PollFrequency: configuration.Frequency(time.Hour), PollPages: []configuration.PollPage{{URL: "https://slow.example.com"}}},
+	}
+	now := time.Now()
+	schedule.apply(nil, configs, now)
+	if wait := schedule.wait(now); wait < 0 || wait >= time.Second {
+		t.Errorf("expected the first check within the jitter of the fast page, got %s", wait)
+	}
+
+	//a single free worker takes one check and the other is skipped
+	jobs := make(chan pageParcel, 1)
+	if dispatched := schedule.dispatch(now.Add(10*time.Minute), jobs); dispatched != 1 {
+		t.Fatalf("expected one check dispatched to the single worker, got %d", dispatched)
+	}
+	first := <-jobs
+	if first.drift < 5*time.Minute {
+		t.Errorf("expected the drift of a late run to be reported, got %s", first.drift)
+	}
+	var other *check
+	for key, c := range schedule.checks {
+		if key != first.key {
+			other = c
+		}
+	}
+	if other.skipped == 0 || other.inFlight {
+		t.Errorf("expected the check without a worker to count a skipped run, got %+v", other)
+	}
+
+	//a check still running skips its next run and reports it when it next runs
+	schedule.finish(first.key)
+	schedule.apply(configs, &configuration.Configuration{(*configs)[0]}, now)
+	fast := schedule.checks[checkKey{serviceName: "Fast", page: "https://fast.example.com"}]
+	schedule.dispatch(fast.next, jobs)
+	run := <-jobs
+	skipped := fast.skipped
+	schedule.dispatch(fast.next, jobs)
+	if len(jobs) != 0 || fast.skipped != skipped+1 {
+		t.Fatalf("expected the in flight check to skip its run, got %+v", fast)
+	}
+	schedule.finish(run.key)
+	schedule.dispatch(fast.next, jobs)
+	if run := <-jobs; run.key != fast.key || run.skipped != skipped+1 {
+		t.Errorf("expected the skipped runs to be reported with the next run, got %+v", run)
+	}
+}
+
+func TestPollHonoursPageDefinition(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("X-Probe") != "sentry" || string(body) != `{"ping":true}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, server.Client())
+	send := func(page configuration.PollPage) configuration.PingResponse {
+		parcel := pageParcel{
+			page:         page,
+			responseData: make(chan configuration.PingResponse),
+			config:       configuration.Config{ServiceName: "Local"},
+		}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	page := configuration.PollPage{
+		ID:             "local-post",
+		URL:            server.URL,
+		Method:         "post",
+		Headers:        map[string]string{"X-Probe": "sentry"},
+		Body:           `{"ping":true}`,
+		Timeout:        configuration.Frequency(5 * time.Second),
+		ExpectedStatus: []int{http.StatusAccepted},
+		Tags:           []string{"local"},
+	}
+	res := send(page)
+	if res.StatusCode != http.StatusAccepted || !res.Passed || res.CheckID != "local-post" || res.Method != http.MethodPost || len(res.Tags) != 1 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	//a GET to the same page is answered with 400 which is not expected
+	res = send(configuration.PollPage{URL: server.URL})
+	if res.StatusCode != http.StatusBadRequest || res.Passed || res.CheckID == "" {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
+
+func TestPollAssertions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status":"ok","version":2,"message":"all systems operational"}`)
+	}))
+	defer server.Close()
+
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, server.Client())
+	send := func(assertions *configuration.Assertions) configuration.PingResponse {
+		parcel := pageParcel{
+			page:         configuration.PollPage{URL: server.URL, Assertions: assertions},
+			responseData: make(chan configuration.PingResponse),
+			config:       configuration.Config{ServiceName: "Local"},
+		}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	res := send(&configuration.Assertions{
+		Status:          []configuration.StatusRange{"2xx"},
+		BodyContains:    []string{"operational"},
+		BodyNotContains: []string{"outage"},
+		BodyMatches:     []string{`"version":\d+`},
+		JSONPath:        []configuration.JSONPathAssertion{{Path: "$.status", Equals: "ok"}, {Path: "$.version", Equals: 2}},
+		MaxResponseTime: configuration.Frequency(10 * time.Second),
+	})
+	if !res.Passed || len(res.FailedAssertions) != 0 {
+		t.Errorf("expected all assertions to pass, got %+v", res)
+	}
+
+	res = send(&configuration.Assertions{
+		Status:               []configuration.StatusRange{"500-599"},
+		BodyContains:         []string{"degraded"},
+		BodyNotMatches:       []string{`all \w+ operational`},
+		JSONPath:             []configuration.JSONPathAssertion{{Path: "$.status", Equals: "down"}, {Path: "$.missing", Equals: true}},
+		MinCertDaysRemaining: 100000,
+	})
+	if res.Passed || len(res.FailedAssertions) != 6 {
+		t.Errorf("expected 6 failed assertions, got %q", res.FailedAssertions)
+	}
+}
+
+func TestNetworkChecks(t *testing.T) {
+	//tcp listener that also echoes
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpListener.Close()
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	//udp echo
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpConn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			udpConn.WriteTo(buf[:n], addr)
+		}
+	}()
+	dnsServer := serveTestDNS(t, map[string]string{"db.example.test.": "10.0.0.7"})
+	defer dnsServer.Close()
+
+	pageChan := make(chan pageParcel)
+	client := newClient()
+	go poll(pageChan, &client)
+	send := func(url string) configuration.PingResponse {
+		parcel := pageParcel{
+			page:         configuration.PollPage{URL: url, Timeout: configuration.Frequency(5 * time.Second)},
+			responseData: make(chan configuration.PingResponse),
+			config:       configuration.Config{ServiceName: "Local"},
+		}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	cases := []struct {
+		url       string
+		checkType configuration.CheckType
+		passed    bool
+	}{
+		{"tcp://" + tcpListener.Addr().String(), configuration.CheckTCP, true},
+		{"tcp://127.0.0.1:1", configuration.CheckTCP, false},
+		{"echo://" + udpConn.LocalAddr().String(), configuration.CheckEcho, true},
+		{"echo://" + tcpListener.Addr().String() + "?network=tcp", configuration.CheckEcho, true},
+		{"dns://" + dnsServer.LocalAddr().String() + "/db.example.test?type=A&expect=10.0.0.7", configuration.CheckDNS, true},
+		{"dns://" + dnsServer.LocalAddr().String() + "/db.example.test?type=A&expect=10.0.0.8", configuration.CheckDNS, false},
+		{"dns://" + dnsServer.LocalAddr().String() + "/missing.example.test", configuration.CheckDNS, false},
+	}
+	for _, tc := range cases {
+		res := send(tc.url)
+		if res.CheckType != tc.checkType || res.Passed != tc.passed {
+			t.Errorf("%s: unexpected response %+v", tc.url, res)
+		}
+	}
+	if res := send("echo://" + udpConn.LocalAddr().String()); len(res.ResolvedAddresses) != 1 || res.ResolvedAddresses[0] != "127.0.0.1" {
+		t.Errorf("unexpected echo addresses %q", res.ResolvedAddresses)
+	}
+	if res := send("dns://" + dnsServer.LocalAddr().String() + "/db.example.test"); len(res.ResolvedAddresses) != 1 || res.ResolvedAddresses[0] != "10.0.0.7" {
+		t.Errorf("unexpected dns answers %q", res.ResolvedAddresses)
+	}
+}
+
+func TestDialEachFallsBack(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	//nothing listens on 127.0.0.2 so the first address is refused
+	res := &configuration.PingResponse{}
+	conn, err := dialEach(ctx, "tcp", []string{"127.0.0.2", "127.0.0.1"}, port, res)
+	if err != nil {
+		t.Fatalf("expected to connect to the second address: %v", err)
+	}
+	conn.Close()
+	if res.ResponseTimes.RemoteIP != "127.0.0.1" {
+		t.Errorf("expected the connected address to be reported, got %q", res.ResponseTimes.RemoteIP)
+	}
+	if _, err := dialEach(ctx, "tcp", []string{"127.0.0.2", "127.0.0.3"}, port, &configuration.PingResponse{}); err == nil || !strings.Contains(err.Error(), "127.0.0.3") {
+		t.Errorf("expected the error of the last address, got %v", err)
+	}
+}
+
+//serveTestDNS answers A queries over UDP from records of fully qualified name to IPv4 address
+func serveTestDNS(t *testing.T, records map[string]string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) != 1 {
+				continue
+			}
+			question := msg.Questions[0]
+			msg.Header.Response = true
+			msg.Header.Authoritative = true
+			msg.Header.RCode = dnsmessage.RCodeNameError
+			msg.Answers = nil
+			if ip, ok := records[question.Name.String()]; ok {
+				msg.Header.RCode = dnsmessage.RCodeSuccess
+				if question.Type == dnsmessage.TypeA {
+					var a [4]byte
+					copy(a[:], net.ParseIP(ip).To4())
+					msg.Answers = append(msg.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: a},
+					})
+				}
+			}
+			out, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return conn
+}
+
+func TestPollFailureCategories(t *testing.T) {
+	//a port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := closed.Addr().String()
+	closed.Close()
+	//a server that resets every connection without responding
+	resetter, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetter.Close()
+	go func() {
+		for {
+			conn, err := resetter.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+		}
+	}()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer untrusted.Close()
+
+	pageChan := make(chan pageParcel)
+	client := newClient()
+	go poll(pageChan, &client)
+
+	cases := []struct {
+		name     string
+		url      string
+		category configuration.ErrorCategory
+	}{
+		{"dns", "http://statussentry.invalid", configuration.ErrorDNS},
+		{"connect", "http://" + refused, configuration.ErrorConnect},
+		{"tls", untrusted.URL, configuration.ErrorTLS},
+		{"timeout", slow.URL, configuration.ErrorTimeout},
+		{"reset", "http://" + resetter.Addr().String(), configuration.ErrorReset},
+		{"http", broken.URL, configuration.ErrorHTTP},
+		{"tcp connect", "tcp://" + refused, configuration.ErrorConnect},
+		{"plain http", healthy.URL, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parcel := pageParcel{
+				page:         configuration.PollPage{URL: tc.url, Timeout: configuration.Frequency(500 * time.Millisecond)},
+				responseData: make(chan configuration.PingResponse),
+				config:       configuration.Config{ServiceName: "Local"},
+			}
+			pageChan <- parcel
+			res := <-parcel.responseData
+			if res.ErrorCategory != tc.category || res.Passed != (tc.category == "") {
+				t.Errorf("expected category %q, got %q (passed %v, error %q)", tc.category, res.ErrorCategory, res.Passed, res.ErrorText)
+			}
+		})
+	}
+}
+
+//slowHandshakeListener delays the first read of every connection so TLS handshakes take measurable time
+type slowHandshakeListener struct {
+	net.Listener
+}
+
+func (l slowHandshakeListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	return &slowFirstRead{Conn: conn}, err
+}
+
+type slowFirstRead struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *slowFirstRead) Read(b []byte) (int, error) {
+	c.once.Do(func() { time.Sleep(20 * time.Millisecond) })
+	return c.Conn.Read(b)
+}
+
+func TestPollTracesEachRequest(t *testing.T) {
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, "ok")
+	}))
+	secure.Listener = slowHandshakeListener{Listener: secure.Listener}
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, secure.Client())
+	send := func(url string) configuration.PingResponse {
+		parcel := pageParcel{
+			page:         configuration.PollPage{URL: url},
+			responseData: make(chan configuration.PingResponse),
+			config:       configuration.Config{ServiceName: "Local"},
+		}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	times := send(secure.URL).ResponseTimes
+	if times.TLSHandshake < 20 || times.ServerProcessing < 10 || times.Total < times.TLSHandshake+times.ServerProcessing {
+		t.Errorf("unexpected https times %+v", times)
+	}
+	if times.Protocol != "HTTP/2.0" || times.RemoteIP != "127.0.0.1" {
+		t.Errorf("unexpected https connection %+v", times)
+	}
+	//the same worker must not report the handshake of the previous request
+	times = send(plain.URL).ResponseTimes
+	if times.TLSHandshake != 0 || times.Protocol != "HTTP/1.1" || times.RemoteIP != "127.0.0.1" {
+		t.Errorf("unexpected http times %+v", times)
+	}
+}
+
+func TestPageTrackerStates(t *testing.T) {
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	run := func(tracker *pageTracker, policy configuration.StatePolicy, verdicts ...bool) []configuration.StateChange {
+		sent := make([]configuration.StateChange, 0)
+		for i, passed := range verdicts {
+			ping := configuration.PingResponse{ServiceName: "Stripe", URL: "https://www.stripe.com", Passed: passed, TimeGo: start.Add(time.Duration(i) * time.Minute)}
+			if change, ok := tracker.observe(ping, policy); ok {
+				sent = append(sent, change)
+			}
+		}
+		return sent
+	}
+
+	//3 consecutive failures by default with the first UP not sent
+	sent := run(newPageTracker(), configuration.StatePolicy{}, true, false, false, false, false, true)
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 state changes, got %+v", sent)
+	}
+	if sent[0].From != configuration.StateUp || sent[0].To != configuration.StateDegraded {
+		t.Errorf("unexpected first change %+v", sent[0])
+	}
+	if sent[1].To != configuration.StateDown || sent[1].OutageStart != start.Add(time.Minute).Format(time.RFC3339) {
+		t.Errorf("unexpected down change %+v", sent[1])
+	}
+	if sent[2].From != configuration.StateDown || sent[2].To != configuration.StateUp || sent[2].OutageSeconds != 240 {
+		t.Errorf("unexpected recovery %+v", sent[2])
+	}
+
+	//2 of the last 4 failed without being consecutive
+	sent = run(newPageTracker(), configuration.StatePolicy{ConsecutiveFailures: 5, FailuresInWindow: 2, Window: 4, FlapChanges: 10}, true, false, true, false)
+	if len(sent) != 3 || sent[2].To != configuration.StateDown {
+		t.Errorf("expected the page to go down on 2 of 4 failures, got %+v", sent)
+	}
+
+	//alternating verdicts flap and the changes in between are held back
+	tracker := newPageTracker()
+	sent = run(tracker, configuration.StatePolicy{ConsecutiveFailures: 1, Window: 6, FlapChanges: 3}, true, false, true, false, true, false, true)
+	if len(sent) != 3 || !sent[2].Flapping || !tracker.flapping {
+		t.Errorf("expected flapping to be reported once after 2 changes, got %+v", sent)
+	}
+	sent = run(tracker, configuration.StatePolicy{ConsecutiveFailures: 1, Window: 6, FlapChanges: 3}, true, true, true, true, true)
+	if len(sent) != 1 || sent[0].Flapping || tracker.flapping {
+		t.Errorf("expected flapping to stop once verdicts settle, got %+v", sent)
+	}
+}
+
+func TestPollRetriesConfirmFailures(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if r.URL.Path == "/blip" && requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, server.Client())
+	send := func(page configuration.PollPage) configuration.PingResponse {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+		parcel := pageParcel{page: page, responseData: make(chan configuration.PingResponse), config: configuration.Config{ServiceName: "Local"}}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+	delay := configuration.Frequency(10 * time.Millisecond)
+
+	res := send(configuration.PollPage{URL: server.URL + "/blip", Retries: 2, RetryDelay: delay})
+	if !res.Passed || len(res.Attempts) != 2 || res.Attempts[0].Passed || res.Attempts[0].StatusCode != http.StatusBadGateway || !res.Attempts[1].Passed {
+		t.Errorf("expected a blip confirmed as passing on retry, got %+v", res)
+	}
+	res = send(configuration.PollPage{URL: server.URL + "/down", Retries: 2, RetryDelay: delay})
+	if res.Passed || len(res.Attempts) != 3 || res.ErrorCategory != configuration.ErrorHTTP {
+		t.Errorf("expected a failure confirmed by 3 attempts, got %+v", res)
+	}
+	res = send(configuration.PollPage{URL: server.URL})
+	if !res.Passed || len(res.Attempts) != 0 {
+		t.Errorf("expected a single attempt for a passing page, got %+v", res)
+	}
+}
+
+//testCA is a locally generated certificate authority for TLS inspection tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(raw)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return testCA{cert: cert, key: key, pool: pool}
+}
+
+//issue returns a server and client certificate for hosts with key, stapled with an OCSP response of ocspStatus
+func (ca testCA) issue(t *testing.T, key crypto.Signer, ocspStatus int, hosts ...string) tls.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+			continue
+		}
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(raw)
+	staple, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       ocspStatus,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{raw, ca.cert.Raw}, PrivateKey: key, Leaf: leaf, OCSPStaple: staple}
+}
+
+func TestPollInspectsTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serve := func(cert tls.Certificate) *httptest.Server {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		server.StartTLS()
+		return server
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}}
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, client)
+	send := func(url string) configuration.PingResponse {
+		parcel := pageParcel{page: configuration.PollPage{URL: url}, responseData: make(chan configuration.PingResponse), config: configuration.Config{ServiceName: "Local"}}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	strong, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	good := serve(ca.issue(t, strong, ocsp.Good, "127.0.0.1"))
+	defer good.Close()
+	res := send(good.URL)
+	if !res.Passed || res.TLS == nil || len(res.Warnings) != 0 {
+		t.Fatalf("expected a sound TLS setup without warnings, got %+v", res)
+	}
+	if !res.TLS.ChainVerified || !res.TLS.HostnameMatch || !res.TLS.OCSPStapled || res.TLS.OCSPStatus != "good" || res.TLS.Version != "TLS 1.3" || res.TLS.CipherSuite == "" {
+		t.Errorf("unexpected TLS inspection %+v", res.TLS)
+	}
+	if leaf := res.Certificates[0]; leaf.KeyAlgorithm != "ECDSA" || leaf.KeyBits != 256 || leaf.SignatureAlgorithm != "ECDSA-SHA256" || len(leaf.Fingerprint) != 64 {
+		t.Errorf("unexpected certificate details %+v", leaf)
+	}
+
+	//a weak key for another host that has been revoked fails the handshake but is still inspected
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := serve(ca.issue(t, weak, ocsp.Revoked, "other.example"))
+	defer bad.Close()
+	res = send(bad.URL)
+	if res.Passed || res.ErrorCategory != configuration.ErrorTLS || res.TLS == nil {
+		t.Fatalf("expected a failed handshake to be inspected, got %+v", res)
+	}
+	if !res.TLS.ChainVerified || res.TLS.HostnameMatch || res.TLS.OCSPStatus != "revoked" || len(res.Certificates) != 2 || res.Certificates[0].KeyBits != 1024 {
+		t.Errorf("unexpected TLS inspection %+v of %+v", res.TLS, res.Certificates)
+	}
+	if len(res.Warnings) != 3 {
+		t.Errorf("expected warnings for the hostname, key and revocation, got %q", res.Warnings)
+	}
+
+	//an old protocol and cipher are flagged
+	info, warnings := inspectTLS(&tls.ConnectionState{Version: tls.VersionTLS10, CipherSuite: tls.TLS_RSA_WITH_RC4_128_SHA, PeerCertificates: []*x509.Certificate{ca.issue(t, strong, ocsp.Good, "localhost").Leaf}}, "localhost", ca.pool, time.Now())
+	if info.Version != "TLS 1.0" || len(warnings) != 2 {
+		t.Errorf("expected warnings for the protocol and cipher, got %+v %q", info, warnings)
+	}
+}
+
+func TestCertLedgerSendsEachThresholdOnce(t *testing.T) {
+	dir := t.TempDir()
+	ledger, err := loadExpiryLedger(dir, certLedgerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//whole seconds as ValidUntil is RFC3339
+	now := time.Now().Truncate(time.Second)
+	thresholds := configuration.Config{}.ExpiryThresholds()
+	ping := func(fingerprint string, validFor time.Duration) configuration.PingResponse {
+		return configuration.PingResponse{ServiceName: "Local", URL: "https://local", Certificates: []configuration.PingCert{
+			{ConnVerified: true, Subject: "local", Fingerprint: fingerprint, ValidUntil: now.Add(validFor).Format(time.RFC3339)},
+			//the chain certificates never send an event
+			{Subject: "Local CA", Fingerprint: "ca" + fingerprint, ValidUntil: now.Add(-time.Hour).Format(time.RFC3339)},
+		}}
+	}
+
+	//first seen past the 30 and 14 day thresholds is sent once for the nearest
+	expiries := certExpiries(ledger, ping("aa", 10*24*time.Hour+time.Hour), thresholds, now)
+	if len(expiries) != 1 || expiries[0].Threshold != 14 || expiries[0].DaysRemaining != 10 {
+		t.Fatalf("expected a single 14 day event, got %+v", expiries)
+	}
+	if err := ledger.save(now); err != nil {
+		t.Fatal(err)
+	}
+	if expiries := certExpiries(ledger, ping("aa", 9*24*time.Hour), thresholds, now); len(expiries) != 0 {
+		t.Errorf("expected no repeat of a sent threshold, got %+v", expiries)
+	}
+
+	//the ledger survives a restart
+	ledger, err = loadExpiryLedger(dir, certLedgerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiries := certExpiries(ledger, ping("aa", 8*24*time.Hour), thresholds, now); len(expiries) != 0 {
+		t.Errorf("expected the reloaded ledger to remember sent thresholds, got %+v", expiries)
+	}
+	if expiries := certExpiries(ledger, ping("aa", -time.Hour), thresholds, now); len(expiries) != 1 || expiries[0].Threshold != 1 || expiries[0].DaysRemaining != -1 {
+		t.Errorf("expected an expired certificate to cross the last threshold, got %+v", expiries)
+	}
+	//a renewed certificate has a new fingerprint and is followed afresh
+	if expiries := certExpiries(ledger, ping("bb", 5*24*time.Hour), thresholds, now); len(expiries) != 1 || expiries[0].Threshold != 7 {
+		t.Errorf("expected a 7 day event for a new certificate, got %+v", expiries)
+	}
+	//a threshold is crossed with exactly its days remaining
+	if expiries := certExpiries(ledger, ping("cc", 30*24*time.Hour), thresholds, now); len(expiries) != 1 || expiries[0].Threshold != 30 || expiries[0].DaysRemaining != 30 {
+		t.Errorf("expected a 30 day event with 30 days remaining, got %+v", expiries)
+	}
+	if expiries := certExpiries(ledger, ping("dd", 31*24*time.Hour), thresholds, now); len(expiries) != 0 {
+		t.Errorf("expected no event with 31 days remaining, got %+v", expiries)
+	}
+}
+
+func TestDomainExpiryChecks(t *testing.T) {
+	expires := time.Now().Add(20*24*time.Hour + time.Hour).UTC()
+	var rdapQueries int32
+	rdap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&rdapQueries, 1)
+		if r.URL.Path != "/domain/example.co.uk" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		fmt.Fprintf(w, `{"ldhName":"example.co.uk","events":[{"eventAction":"registration","eventDate":"2001-01-01T00:00:00Z"},{"eventAction":"expiration","eventDate":%q}],
+			"entities":[{"roles":["registrar"],"vcardArray":["vcard",[["version",{},"text","4.0"],["fn",{},"text","Test Registrar Ltd"]]]}]}`, expires.Format(time.RFC3339))
+	}))
+	defer rdap.Close()
+
+	//the WHOIS stand-in refers to itself once then answers for the domains RDAP does not know
+	whois, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer whois.Close()
+	go func() {
+		for {
+			conn, err := whois.Accept()
+			if err != nil {
+				return
+			}
+			query := make([]byte, 256)
+			n, _ := conn.Read(query)
+			switch string(query[:n]) {
+			case "example.org\r\n":
+				fmt.Fprintf(conn, "%% stand-in\r\nDomain Name: EXAMPLE.ORG\r\nRegistrar: Whois Registrar Inc.\r\nRegistry Expiry Date: %s\r\n", time.Now().Add(3*24*time.Hour+time.Hour).UTC().Format("2006-01-02T15:04:05Z"))
+			case "example.net\r\n":
+				fmt.Fprintf(conn, "refer: %s\r\n", whois.Addr())
+			}
+			conn.Close()
+		}
+	}()
+
+	checker := &domainChecker{rdapBase: rdap.URL, whoisServer: whois.Addr().String(), client: rdap.Client(), refresh: time.Hour}
+	checker.ledger, _ = loadExpiryLedger("", domainLedgerFile)
+	configs := &configuration.Configuration{
+		{ServiceName: "Shop", DisplayDomain: "www.example.co.uk", PollPages: []configuration.PollPage{{URL: "https://api.example.co.uk/health"}, {URL: "tcp://db.example.org:5432"}, {URL: "https://127.0.0.1/"}}},
+		{ServiceName: "Unknown", DisplayDomain: "example.net"},
+	}
+	sender := make(chan configuration.Transporter, 10)
+	checker.check(context.Background(), configs, sender, time.Now())
+	if len(sender) != 2 {
+		t.Fatalf("expected an event for each of the 2 registered domains found, got %d", len(sender))
+	}
+	byDomain := make(map[string]*configuration.DomainExpiry)
+	for len(sender) > 0 {
+		event := <-sender
+		if event.Type() != configuration.EventDomainExpiry {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		byDomain[event.DomainExpiry.Domain] = event.DomainExpiry
+	}
+	if expiry := byDomain["example.co.uk"]; expiry == nil || expiry.Source != "rdap" || expiry.Registrar != "Test Registrar Ltd" || expiry.Threshold != 30 || expiry.DaysRemaining != 20 {
+		t.Errorf("unexpected RDAP expiry %+v", expiry)
+	}
+	if expiry := byDomain["example.org"]; expiry == nil || expiry.Source != "whois" || expiry.Registrar != "Whois Registrar Inc." || expiry.Threshold != 7 {
+		t.Errorf("unexpected WHOIS expiry %+v", expiry)
+	}
+
+	//as after a config reload the registrations looked up within refresh are reused
+	queries := atomic.LoadInt32(&rdapQueries)
+	checker.check(context.Background(), configs, sender, time.Now())
+	if len(sender) != 0 {
+		t.Errorf("expected thresholds already sent not to be sent again, got %d events", len(sender))
+	}
+	if got := atomic.LoadInt32(&rdapQueries); got != queries {
+		t.Errorf("expected registrations to be reused within refresh, got %d more RDAP queries", got-queries)
+	}
+	checker.check(context.Background(), configs, sender, time.Now().Add(2*time.Hour))
+	if got := atomic.LoadInt32(&rdapQueries); got == queries {
+		t.Error("expected registrations older than refresh to be looked up again")
+	}
+}
+
+func TestContentChanges(t *testing.T) {
+	var mu sync.Mutex
+	banner, served := "All systems operational", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		served++
+		fmt.Fprintf(w, `<html><body><nav>Menu %d</nav><div id="status"><p class="banner">%s</p><p>Updated %s</p></div></body></html>`,
+			served, banner, time.Now().Add(time.Duration(served)*time.Minute).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	ledger, err := loadExpiryLedger("", certLedgerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := configuration.Config{ServiceName: "Local"}
+	page := configuration.PollPage{URL: server.URL, Content: &configuration.ContentWatch{
+		Selector: "#status",
+		Ignore:   []string{`Updated \S+`},
+	}}
+	c := &check{key: checkKey{serviceName: config.ServiceName, page: page.Key()}, config: config, page: page, tracker: newPageTracker()}
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, server.Client())
+	changes := func() []configuration.ContentChange {
+		parcel := pageParcel{key: c.key, page: page, config: config, responseData: make(chan configuration.PingResponse), content: c.content, contentHash: c.contentHash}
+		pageChan <- parcel
+		sender := make(chan configuration.Transporter, 10)
+		report(finishRun(parcel, <-parcel.responseData), c, ledger, sender)
+		close(sender)
+		out := make([]configuration.ContentChange, 0)
+		for transport := range sender {
+			if transport.ContentChange != nil {
+				out = append(out, *transport.ContentChange)
+			}
+		}
+		return out
+	}
+
+	if got := changes(); len(got) != 0 {
+		t.Fatalf("expected the first content to only set the baseline, got %+v", got)
+	}
+	//the menu is outside the selector and the timestamp is ignored
+	if got := changes(); len(got) != 0 {
+		t.Fatalf("expected no change from ignored content, got %+v", got)
+	}
+	mu.Lock()
+	banner = "Partial outage"
+	mu.Unlock()
+	got := changes()
+	if len(got) != 1 || got[0].OldHash == got[0].NewHash || got[0].Diff != "- All systems operational\n+ Partial outage" {
+		t.Fatalf("expected a single change with a diff of the banner, got %+v", got)
+	}
+	if got := changes(); len(got) != 0 {
+		t.Errorf("expected no repeat of a change already sent, got %+v", got)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		old, new, want string
+	}{
+		{"a\nb\nc", "a\nb\nc", ""},
+		{"", "a", "+ a"},
+		{"a\nb\nc", "a\nc\nd", "- b\n+ d"},
+		{"a\nb", "b\na", "- a\n+ a"},
+	}
+	for _, test := range tests {
+		if got := lineDiff(test.old, test.new); got != test.want {
+			t.Errorf("lineDiff(%q, %q) = %q, want %q", test.old, test.new, got, test.want)
+		}
+	}
+	//a long diff is cut at the start of a character
+	if got := lineDiff("", strings.Repeat("€", 2000)); len(got) > maxDiffBytes+4 || !utf8.ValidString(got) || !strings.HasSuffix(got, "\n...") {
+		t.Errorf("expected a valid diff cut at maxDiffBytes, got %d bytes valid %v", len(got), utf8.ValidString(got))
+	}
+	//long pages with edits throughout are diffed without a table of every pair of lines
+	old, new := make([]string, maxDiffLines), make([]string, maxDiffLines)
+	for i := range old {
+		old[i], new[i] = fmt.Sprintf("line %d", i), fmt.Sprintf("line %d", i)
+		if i%100 == 0 {
+			new[i] = fmt.Sprintf("changed %d", i)
+		}
+	}
+	if got := lineDiff(strings.Join(old, "\n"), strings.Join(new, "\n")); strings.Count(got, "\n") != 39 || !strings.Contains(got, "- line 1900\n") || !strings.Contains(got, "+ changed 1900") {
+		t.Errorf("expected a removed and added line for each of the 20 changes, got %q", got)
+	}
+}
+
+func TestPollSyntheticSteps(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		io.WriteString(w, `{"token":"t1","user":{"id":42}}`)
+	})
+	mux.HandleFunc("/users/42", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "s1" || r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"name":"Ada"}`)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, server.Client())
+	send := func(steps ...configuration.Step) configuration.PingResponse {
+		parcel := pageParcel{
+			page:         configuration.PollPage{URL: "synthetic://account", Steps: steps},
+			responseData: make(chan configuration.PingResponse),
+			config:       configuration.Config{ServiceName: "Local"},
+		}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+	login := configuration.Step{Name: "login", URL: server.URL + "/login", Method: "POST", Extract: []configuration.Extraction{
+		{Name: "token", JSONPath: "$.token"},
+		{Name: "user", Regex: `"id":(\d+)`},
+	}}
+	profile := configuration.Step{Name: "profile", URL: server.URL + "/users/{{user}}", Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+		Assertions: &configuration.Assertions{BodyContains: []string{"Ada"}}}
+	logout := configuration.Step{Name: "logout", URL: server.URL + "/logout", Method: "POST", ExpectedStatus: []int{204}}
+
+	res := send(login, profile, logout)
+	if !res.Passed || res.CheckType != configuration.CheckSynthetic || len(res.Steps) != 3 || res.StatusCode != 204 {
+		t.Fatalf("expected all three steps to pass, got %+v", res)
+	}
+	if extracted := res.Steps[0].Extracted; len(extracted) != 2 || res.Steps[1].ResponseTimes.Total > res.ResponseTimes.Total {
+		t.Errorf("unexpected step results %+v", res.Steps)
+	}
+
+	//a failed step stops the steps after it
+	profile.Assertions.BodyContains = []string{"Grace"}
+	res = send(login, profile, logout)
+	if res.Passed || len(res.Steps) != 2 || res.Steps[1].Passed || len(res.FailedAssertions) != 1 || res.FailedAssertions[0] != `profile: body does not contain "Grace"` {
+		t.Errorf("expected the profile step to fail, got %+v", res)
+	}
+	login.Extract = []configuration.Extraction{{Name: "token", JSONPath: "$.missing"}}
+	if res = send(login, profile); res.Passed || len(res.Steps) != 1 {
+		t.Errorf("expected the login step to fail to extract, got %+v", res)
+	}
+}
+
+func TestSyntheticAuthStaysOnFirstHost(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[name] = r.Header.Get("Authorization")
+		}
+	}
+	api := httptest.NewServer(record("api"))
+	defer api.Close()
+	other := httptest.NewServer(record("other"))
+	defer other.Close()
+
+	t.Setenv("TEST_SYNTHETIC_TOKEN", "token-1")
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, api.Client())
+	parcel := pageParcel{
+		page: configuration.PollPage{URL: "synthetic://account", Auth: &configuration.PageAuth{Bearer: "env:TEST_SYNTHETIC_TOKEN"}, Steps: []configuration.Step{
+			{Name: "api", URL: api.URL + "/me"},
+			{Name: "other", URL: other.URL + "/track"},
+		}},
+		responseData: make(chan configuration.PingResponse),
+		config:       configuration.Config{ServiceName: "Local"},
+	}
+	pageChan <- parcel
+	if res := <-parcel.responseData; !res.Passed {
+		t.Fatalf("expected both steps to pass, got %+v", res)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if seen["api"] != "Bearer token-1" {
+		t.Errorf("expected the first step to be sent the bearer token, got %q", seen["api"])
+	}
+	if auth, ok := seen["other"]; !ok || auth != "" {
+		t.Errorf("expected the step to another host to be sent without an Authorization header, got %q", auth)
+	}
+}
+
+func TestPollSendsAuth(t *testing.T) {
+	ca := newTestCA(t)
+	serverKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" || r.Header.Get("X-Api-Key") != "key-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, serverKey, ocsp.Good, "127.0.0.1")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	//the secrets are only found in the environment and files
+	dir := t.TempDir()
+	write := func(name string, data []byte) configuration.SecretRef {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return configuration.SecretRef("file:" + path)
+	}
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientCert := ca.issue(t, clientKey, ocsp.Good, "client.internal")
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	t.Setenv("TEST_PING_TOKEN", "token-1")
+	auth := &configuration.PageAuth{
+		Bearer:     "env:TEST_PING_TOKEN",
+		Headers:    map[string]configuration.SecretRef{"X-Api-Key": write("api_key", []byte("key-1\n"))},
+		ClientCert: write("client.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]})),
+		ClientKey:  write("client.key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		CABundle:   write("ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})),
+	}
+	if errs := auth.Validate(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	client := newClient()
+	pageChan := make(chan pageParcel)
+	go poll(pageChan, &client)
+	send := func(auth *configuration.PageAuth) configuration.PingResponse {
+		parcel := pageParcel{page: configuration.PollPage{URL: server.URL, Auth: auth}, responseData: make(chan configuration.PingResponse), config: configuration.Config{ServiceName: "Local"}}
+		pageChan <- parcel
+		return <-parcel.responseData
+	}
+
+	res := send(auth)
+	if !res.Passed || res.TLS == nil || !res.TLS.ChainVerified {
+		t.Fatalf("expected the authenticated mTLS ping to pass, got %+v", res)
+	}
+	if encoded, _ := json.Marshal(res); strings.Contains(string(encoded), "token-1") || strings.Contains(string(encoded), "key-1") {
+		t.Errorf("expected no secret in the ping, got %s", encoded)
+	}
+	if res := send(&configuration.PageAuth{Bearer: auth.Bearer, Headers: auth.Headers, CABundle: auth.CABundle}); res.Passed {
+		t.Errorf("expected a ping without the client certificate to fail, got %+v", res)
+	}
+	os.Unsetenv("TEST_PING_TOKEN")
+	if res := send(auth); res.Passed || !strings.Contains(res.ErrorText, "TEST_PING_TOKEN is not set") {
+		t.Errorf("expected a missing secret to fail the ping, got %+v", res)
+	}
+}
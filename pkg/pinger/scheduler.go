@@ -0,0 +1,211 @@
+package pinger
+
+import (
+	"container/heap"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//maxJitter caps the random delay added to each run of a check so checks of the same frequency do not all fire together
+const maxJitter = 30 * time.Second
+
+//jitterFraction is the largest share of its frequency a run of a check is delayed by
+const jitterFraction = 10
+
+//checkKey identifies a check by the ServiceName of its Config and its PollPage.Key
+type checkKey struct {
+	serviceName string
+	page        string
+}
+
+//check is the scheduling state of a single page of a Config.PollPages
+type check struct {
+	key     checkKey
+	config  configuration.Config
+	page    configuration.PollPage
+	tracker *pageTracker //tracker follows the up/down state of the page across its pings
+
+	content     string //content is the last watched content of a page with a ContentWatch
+	contentHash string //contentHash is the hash of content. Empty until the content is first seen
+
+	base     time.Time //base is the time the next run is due before jitter. Moves on by the frequency to keep the cadence
+	next     time.Time //next is the time the next run is due with jitter
+	index    int       //index is the position of the check in the scheduleHeap
+	inFlight bool      //inFlight is whether a run of the check is with the worker pool
+	skipped  int       //skipped is the number of runs missed since the last dispatched run
+}
+
+//frequency returns how often the check runs
+func (c *check) frequency() time.Duration {
+	freq := c.config.PageFrequency(c.page)
+	if freq <= 0 { //validation stops this but a zero frequency must never spin the scheduler
+		freq = time.Minute
+	}
+	return freq
+}
+
+//scheduleHeap orders checks by their next run time. Implements heap.Interface
+type scheduleHeap []*check
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	c := x.(*check)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	c.index = -1
+	return c
+}
+
+//scheduler runs each check on its own frequency with jitter. Not safe for concurrent use: owned by the Ping goroutine
+type scheduler struct {
+	queue  scheduleHeap
+	checks map[checkKey]*check
+	random *rand.Rand
+}
+
+//newScheduler returns an empty scheduler
+func newScheduler() *scheduler {
+	return &scheduler{
+		checks: make(map[checkKey]*check),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+//jitter returns a random delay of up to a tenth of freq, capped at maxJitter
+func (s *scheduler) jitter(freq time.Duration) time.Duration {
+	limit := freq / jitterFraction
+	if limit > maxJitter {
+		limit = maxJitter
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(s.random.Int63n(int64(limit)))
+}
+
+//apply reconciles the scheduled checks with the new Configuration at now and returns the Diff from old.
+//
+//Checks for pages found in both keep their schedule and state. New checks are due within their jitter of now.
+// Checks for removed services and pages are dropped
+func (s *scheduler) apply(old, new *configuration.Configuration, now time.Time) configuration.Diff {
+	diff := configuration.DiffConfigurations(old, new)
+	wanted := make(map[checkKey]bool)
+	for _, item := range *new {
+		for _, page := range item.PollPages {
+			key := checkKey{serviceName: item.ServiceName, page: page.Key()}
+			wanted[key] = true
+			if existing, ok := s.checks[key]; ok {
+				existing.config = item
+				existing.page = page
+				//a shorter frequency brings the next run forward
+				if freq := existing.frequency(); existing.base.After(now.Add(freq)) {
+					existing.base = now.Add(freq)
+					existing.next = existing.base.Add(s.jitter(freq))
+					heap.Fix(&s.queue, existing.index)
+				}
+				continue
+			}
+			c := &check{key: key, config: item, page: page, tracker: newPageTracker(), base: now}
+			c.next = now.Add(s.jitter(c.frequency()))
+			s.checks[key] = c
+			heap.Push(&s.queue, c)
+		}
+	}
+	for key, c := range s.checks {
+		if !wanted[key] {
+			heap.Remove(&s.queue, c.index)
+			delete(s.checks, key)
+		}
+	}
+	return diff
+}
+
+//wait returns how long from now until the next check is due. An hour if there are no checks
+func (s *scheduler) wait(now time.Time) time.Duration {
+	if len(s.queue) == 0 {
+		return time.Hour
+	}
+	wait := s.queue[0].next.Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+//dispatch hands every check due at now to a free worker through jobs without blocking and schedules its next run.
+//
+//A due run is skipped, and counted in the next PingResponse of the check, if its previous run is still going
+// or no worker is free. Returns the number of runs dispatched
+func (s *scheduler) dispatch(now time.Time, jobs chan<- pageParcel) int {
+	dispatched := 0
+	for len(s.queue) > 0 && !s.queue[0].next.After(now) {
+		c := s.queue[0]
+		drift := now.Sub(c.next)
+		switch {
+		case c.inFlight:
+			c.skipped++
+			log.Printf("skipped check %s of %s: previous run still going", c.page.Key(), c.config.ServiceName)
+		default:
+			parcel := pageParcel{
+				key:     c.key,
+				page:    c.page,
+				config:  c.config,
+				drift:   drift,
+				skipped: c.skipped,
+
+				content:     c.content,
+				contentHash: c.contentHash,
+			}
+			select {
+			case jobs <- parcel:
+				c.inFlight = true
+				c.skipped = 0
+				dispatched++
+			default:
+				c.skipped++
+				log.Printf("skipped check %s of %s: worker pool saturated", c.page.Key(), c.config.ServiceName)
+			}
+		}
+		s.reschedule(c, now)
+	}
+	return dispatched
+}
+
+//reschedule moves the next run of c on by its frequency from its last due time, counting any runs already missed by now as skipped
+func (s *scheduler) reschedule(c *check, now time.Time) {
+	freq := c.frequency()
+	c.base = c.base.Add(freq)
+	for !c.base.After(now) {
+		c.base = c.base.Add(freq)
+		c.skipped++
+	}
+	c.next = c.base.Add(s.jitter(freq))
+	heap.Fix(&s.queue, c.index)
+}
+
+//finish marks the run of the check at key as done and returns the check. Nil if the check was removed while it ran
+func (s *scheduler) finish(key checkKey) *check {
+	c, ok := s.checks[key]
+	if !ok {
+		return nil
+	}
+	c.inFlight = false
+	return c
+}
@@ -0,0 +1,128 @@
+package pinger
+
+import (
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//pageTracker follows the PageState of a single check from the verdicts of its pings
+type pageTracker struct {
+	state       configuration.PageState
+	recent      []bool    //recent are the verdicts of the last StatePolicy.Window pings, oldest first
+	failures    int       //failures is the number of failed pings in a row
+	successes   int       //successes is the number of passed pings in a row
+	flapping    bool      //flapping is whether the verdicts are changing too often to report each change
+	outageStart time.Time //outageStart is the time of the first failed ping since the page was last UP
+}
+
+//newPageTracker returns a pageTracker in the UNKNOWN state
+func newPageTracker() *pageTracker {
+	return &pageTracker{state: configuration.StateUnknown}
+}
+
+//observe moves the tracker on with the verdict of ping and returns the StateChange to send, if any.
+//
+//Changes are sent when the PageState changes or flapping starts or stops. The first UP of a page is not
+// sent as nothing has changed for consumers, nor are changes while the page is flapping
+func (tracker *pageTracker) observe(ping configuration.PingResponse, policy configuration.StatePolicy) (configuration.StateChange, bool) {
+	policy = policy.WithDefaults()
+	at := ping.TimeGo
+	if at.IsZero() {
+		at = time.Now()
+	}
+	tracker.recent = append(tracker.recent, ping.Passed)
+	if len(tracker.recent) > policy.Window {
+		tracker.recent = tracker.recent[len(tracker.recent)-policy.Window:]
+	}
+	if ping.Passed {
+		tracker.successes++
+		tracker.failures = 0
+	} else {
+		tracker.failures++
+		tracker.successes = 0
+		if tracker.outageStart.IsZero() {
+			tracker.outageStart = at
+		}
+	}
+
+	prev := tracker.state
+	next := prev
+	switch {
+	case ping.Passed && (prev == configuration.StateUnknown || prev == configuration.StateUp || tracker.successes >= policy.RecoverySuccesses):
+		next = configuration.StateUp
+	case !ping.Passed && (tracker.failures >= policy.ConsecutiveFailures || (policy.FailuresInWindow > 0 && tracker.windowFailures() >= policy.FailuresInWindow)):
+		next = configuration.StateDown
+	case !ping.Passed && prev != configuration.StateDown:
+		next = configuration.StateDegraded
+	}
+	tracker.state = next
+
+	change := configuration.StateChange{
+		ServiceName: ping.ServiceName,
+		CheckID:     ping.CheckID,
+		URL:         ping.URL,
+		From:        prev,
+		To:          next,
+		Time:        at.Format(time.RFC3339),
+		Reason:      pingReason(ping),
+	}
+	if !tracker.outageStart.IsZero() {
+		change.OutageStart = tracker.outageStart.Format(time.RFC3339)
+		change.OutageSeconds = int64(at.Sub(tracker.outageStart).Seconds())
+	}
+	if next == configuration.StateUp {
+		tracker.outageStart = time.Time{}
+	}
+
+	//flapping starts at FlapChanges changes of verdict within the window and stops below half that
+	changes := tracker.verdictChanges()
+	switch {
+	case !tracker.flapping && changes >= policy.FlapChanges:
+		tracker.flapping = true
+		change.Flapping = true
+		return change, true
+	case tracker.flapping && changes*2 < policy.FlapChanges:
+		tracker.flapping = false
+		return change, true
+	case tracker.flapping:
+		return change, false
+	}
+	change.Flapping = tracker.flapping
+	return change, prev != next && !(prev == configuration.StateUnknown && next == configuration.StateUp)
+}
+
+//windowFailures returns the number of failed pings within the window
+func (tracker *pageTracker) windowFailures() int {
+	count := 0
+	for _, passed := range tracker.recent {
+		if !passed {
+			count++
+		}
+	}
+	return count
+}
+
+//verdictChanges returns the number of changes between pass and fail within the window
+func (tracker *pageTracker) verdictChanges() int {
+	count := 0
+	for i := 1; i < len(tracker.recent); i++ {
+		if tracker.recent[i] != tracker.recent[i-1] {
+			count++
+		}
+	}
+	return count
+}
+
+//pingReason describes why ping failed, or is empty if it passed
+func pingReason(ping configuration.PingResponse) string {
+	if ping.Passed {
+		return ""
+	}
+	reasons := make([]string, 0)
+	if ping.ErrorText != "" {
+		reasons = append(reasons, ping.ErrorText)
+	}
+	return strings.Join(append(reasons, ping.FailedAssertions...), "; ")
+}
@@ -0,0 +1,212 @@
+package pinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"github.com/karlsburg87/statusSentry/pkg/jsonpath"
+)
+
+//pollSynthetic runs the Steps of a synthetic page in order with a fresh cookie jar, passing values extracted
+// from each response on to the later steps. Stops at the first step that fails.
+//
+//The PingResponse has the result of each step in Steps and is timed from the start of the first step to the end of the last.
+// The page Auth is only sent with steps to the scheme and host of the first step
+func pollSynthetic(page pageParcel, client *http.Client) configuration.PingResponse {
+	ctx, cancel := context.WithCancel(context.Background())
+	if page.page.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(page.page.Timeout))
+	}
+	defer cancel()
+	tme := time.Now()
+	out := configuration.PingResponse{
+		StatusPage:   page.config.StatusPage,
+		ServiceName:  page.config.ServiceName,
+		Domain:       page.config.DisplayDomain,
+		CheckID:      page.page.CheckID(page.config.ServiceName),
+		Tags:         page.page.Tags,
+		URL:          page.page.URL,
+		Time:         tme.Format(time.RFC3339),
+		TimeGo:       tme,
+		Certificates: make([]configuration.PingCert, 0),
+		CheckType:    configuration.CheckSynthetic,
+	}
+	authed, err := authClient(client, page.page.Auth)
+	if err != nil {
+		log.Printf("error setting up the client certificate for synthetic check %s: %v", page.page.URL, err)
+		return recordFailure(out, err, configuration.ErrorTLS)
+	}
+	//cookies set by one step are sent by the next, and never shared with other runs
+	jar, _ := cookiejar.New(nil)
+	creds := stepCredentials{auth: page.page.Auth, plain: *client, authed: *authed}
+	creds.plain.Jar, creds.authed.Jar = jar, jar
+	if len(page.page.Steps) > 0 {
+		creds.origin = urlOrigin(page.page.Steps[0].URL)
+	}
+
+	values := make(map[string]string)
+	out.Steps = make([]configuration.StepResult, 0, len(page.page.Steps))
+	for i, step := range page.page.Steps {
+		result, body, res := runStep(ctx, &creds, step.StepName(i), step, values)
+		if res != nil && len(out.Certificates) == 0 {
+			out.Certificates = pingCerts(res.TLS)
+		}
+		if result.Passed {
+			result.Extracted, result.FailedAssertions = extractValues(step.Extract, body, values)
+			result.Passed = len(result.FailedAssertions) == 0
+		}
+		out.Steps = append(out.Steps, result)
+		out.StatusCode = result.StatusCode
+		if !result.Passed {
+			out.ErrorText = fmt.Sprintf("%s failed", result.Name)
+			if result.ErrorText != "" {
+				out.ErrorText = fmt.Sprintf("%s failed: %s", result.Name, result.ErrorText)
+			}
+			out.ErrorCategory = result.ErrorCategory
+			for _, failure := range result.FailedAssertions {
+				out.FailedAssertions = append(out.FailedAssertions, fmt.Sprintf("%s: %s", result.Name, failure))
+			}
+			break
+		}
+	}
+	elapsed := time.Since(tme)
+	out.ResponseTimes = configuration.PingTimes{Total: elapsed.Milliseconds()}
+	if failure := responseTimeFailure(page.page.Assertions, elapsed); failure != "" {
+		out.FailedAssertions = append(out.FailedAssertions, failure)
+	}
+	out.Passed = out.ErrorText == "" && len(out.FailedAssertions) == 0
+	return out
+}
+
+//stepCredentials are the sessions of the steps of a synthetic check. The credentials and client certificate of auth
+// are only used for steps to origin so they never leak to another host a step calls
+type stepCredentials struct {
+	origin string //origin is the scheme and host of the first step
+	auth   *configuration.PageAuth
+	plain  http.Client //plain is the session without credentials
+	authed http.Client //authed is the session with the client certificate of auth
+}
+
+//forURL returns the session and credentials for a step to rawURL
+func (creds *stepCredentials) forURL(rawURL string) (*http.Client, *configuration.PageAuth) {
+	if creds.origin != "" && urlOrigin(rawURL) == creds.origin {
+		return &creds.authed, creds.auth
+	}
+	return &creds.plain, nil
+}
+
+//urlOrigin returns the lower case scheme and host of rawURL, or an empty string if it has neither
+func urlOrigin(rawURL string) string {
+	uri, err := url.Parse(rawURL)
+	if err != nil || uri.Scheme == "" || uri.Host == "" {
+		return ""
+	}
+	return strings.ToLower(uri.Scheme + "://" + uri.Host)
+}
+
+//runStep makes the request of step with the values extracted so far, and the credentials of creds for its URL, and checks
+// the response against its assertions.
+//
+//Returns the StepResult with the body read for extraction, and the response if there was one
+func runStep(ctx context.Context, creds *stepCredentials, name string, step configuration.Step, values map[string]string) (configuration.StepResult, []byte, *http.Response) {
+	result := configuration.StepResult{Name: name, URL: step.URL, Method: step.Page().HTTPMethod()}
+	fail := func(err error, fallback configuration.ErrorCategory) (configuration.StepResult, []byte, *http.Response) {
+		result.ErrorText, result.ErrorCategory = err.Error(), classifyError(err, fallback)
+		return result, nil, nil
+	}
+	step, err := step.Expand(values)
+	if err != nil {
+		return fail(err, configuration.ErrorHTTP)
+	}
+	page := step.Page()
+	client, auth := creds.forURL(step.URL)
+	page.Auth = auth
+	req, err := newPageRequest(ctx, page)
+	if err != nil {
+		return fail(err, configuration.ErrorHTTP)
+	}
+	trace := newRequestTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	res, err := client.Do(req)
+	if err != nil {
+		log.Printf("error on client.Do for step %s of %s: %v", name, step.URL, err)
+		result.ResponseTimes = trace.times(time.Now(), "")
+		return fail(err, configuration.ErrorHTTP)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodyBytes))
+	res.Body.Close()
+	end := time.Now()
+	result.ResponseTimes = trace.times(end, res.Proto)
+	result.StatusCode = res.StatusCode
+	if err != nil { //the connection failed part way through the body
+		result.ErrorText, result.ErrorCategory = err.Error(), classifyError(err, configuration.ErrorHTTP)
+		return result, nil, res
+	}
+	result.FailedAssertions = evaluateAssertions(page, res.StatusCode, body, end.Sub(trace.start), res.TLS)
+	if !page.IsExpectedStatus(res.StatusCode) {
+		result.ErrorText, result.ErrorCategory = res.Status, configuration.ErrorHTTP
+	}
+	result.Passed = result.ErrorText == "" && len(result.FailedAssertions) == 0
+	return result, body, res
+}
+
+//extractValues adds the value of each of extract found in body to values.
+//
+//Returns the names extracted and a failure for each value not found
+func extractValues(extract []configuration.Extraction, body []byte, values map[string]string) (names, failed []string) {
+	var doc interface{}
+	var docErr error
+	parsed := false
+	for _, ex := range extract {
+		var value string
+		var found bool
+		switch {
+		case ex.JSONPath != "":
+			if !parsed {
+				docErr, parsed = json.Unmarshal(body, &doc), true
+			}
+			path, err := jsonpath.Parse(ex.JSONPath)
+			if err != nil || docErr != nil {
+				break
+			}
+			var raw interface{}
+			if raw, found = path.Lookup(doc); found {
+				if text, ok := raw.(string); ok {
+					value = text
+				} else {
+					encoded, _ := json.Marshal(raw)
+					value = string(encoded)
+				}
+			}
+		default:
+			re, err := regexp.Compile(ex.Regex)
+			if err != nil {
+				break
+			}
+			if match := re.FindSubmatch(body); match != nil {
+				value, found = string(match[0]), true
+				if len(match) > 1 {
+					value = string(match[1])
+				}
+			}
+		}
+		if !found {
+			failed = append(failed, fmt.Sprintf("could not extract %s", ex.Name))
+			continue
+		}
+		values[ex.Name] = value
+		names = append(names, ex.Name)
+	}
+	return names, failed
+}
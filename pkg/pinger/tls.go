@@ -0,0 +1,191 @@
+package pinger
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	probeTimeout = 10 * time.Second //probeTimeout limits the handshake made to inspect a certificate a check failed on
+	minRSABits   = 2048             //minRSABits is the smallest RSA key not flagged as weak
+	minECDSABits = 256              //minECDSABits is the smallest ECDSA key not flagged as weak
+)
+
+//tlsVersions are the names of the TLS versions
+var tlsVersions = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+//weakSignatures are the certificate signature algorithms that can be forged
+var weakSignatures = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+//inspectTLS returns the TLSInfo of the connection state of a check of host at now with any warnings about it.
+//
+//The chain is verified against roots, or the system roots if nil
+func inspectTLS(state *tls.ConnectionState, host string, roots *x509.CertPool, now time.Time) (*configuration.TLSInfo, []string) {
+	warnings := make([]string, 0)
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, warnings
+	}
+	info := &configuration.TLSInfo{
+		Version:     tlsVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		OCSPStapled: len(state.OCSPResponse) > 0,
+	}
+	if state.Version < tls.VersionTLS12 {
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated: use TLS 1.2 or later", info.Version))
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.ID == state.CipherSuite {
+			warnings = append(warnings, fmt.Sprintf("cipher suite %s is insecure", info.CipherSuite))
+		}
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now}); err != nil {
+		info.ChainError = err.Error()
+		warnings = append(warnings, fmt.Sprintf("certificate chain does not verify: %v", err))
+	} else {
+		info.ChainVerified = true
+	}
+	if err := leaf.VerifyHostname(host); err != nil {
+		warnings = append(warnings, fmt.Sprintf("certificate does not match host: %v", err))
+	} else {
+		info.HostnameMatch = true
+	}
+
+	for _, cert := range state.PeerCertificates {
+		algorithm, bits := certKey(cert)
+		switch {
+		case algorithm == "RSA" && bits < minRSABits, algorithm == "ECDSA" && bits < minECDSABits, algorithm == "DSA":
+			warnings = append(warnings, fmt.Sprintf("certificate %s has a weak %d bit %s key", cert.Subject.CommonName, bits, algorithm))
+		}
+		//the signature of a self signed root is never checked so cannot weaken the chain
+		if weakSignatures[cert.SignatureAlgorithm] && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			warnings = append(warnings, fmt.Sprintf("certificate %s has a weak %s signature", cert.Subject.CommonName, cert.SignatureAlgorithm))
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			warnings = append(warnings, fmt.Sprintf("certificate %s is outside its validity period %s to %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339)))
+		}
+	}
+
+	if info.OCSPStapled {
+		var issuer *x509.Certificate
+		if len(state.PeerCertificates) > 1 {
+			issuer = state.PeerCertificates[1]
+		}
+		info.OCSPStatus = "invalid"
+		res, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+		switch {
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("stapled OCSP response is invalid: %v", err))
+		case res.Status == ocsp.Good:
+			info.OCSPStatus = "good"
+		case res.Status == ocsp.Revoked:
+			info.OCSPStatus = "revoked"
+			warnings = append(warnings, fmt.Sprintf("stapled OCSP response says the certificate was revoked at %s", res.RevokedAt.Format(time.RFC3339)))
+		default:
+			info.OCSPStatus = "unknown"
+		}
+	}
+	return info, warnings
+}
+
+//tlsVersionName returns the name of a TLS version such as TLS 1.3
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersions[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+//certKey returns the algorithm and size in bits of the public key of cert
+func certKey(cert *x509.Certificate) (algorithm string, bits int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	}
+	return cert.PublicKeyAlgorithm.String(), 0
+}
+
+//certFingerprint returns the hex SHA-256 of cert
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+//clientRoots returns the root CAs the client verifies servers against. Nil for the system roots
+func clientRoots(client *http.Client) *x509.CertPool {
+	if transport, ok := client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig.RootCAs
+	}
+	return nil
+}
+
+//probeTLS completes a TLS handshake with the host of target without verifying it so a certificate a check failed on can be inspected
+func probeTLS(target *url.URL, timeout time.Duration) (*tls.ConnectionState, error) {
+	addr := target.Host
+	if target.Port() == "" {
+		addr = net.JoinHostPort(target.Hostname(), "443")
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{
+		ServerName:         target.Hostname(),
+		InsecureSkipVerify: true, //verified by inspectTLS
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	return &state, nil
+}
+
+//inspectFailedTLS returns the certificates and TLSInfo of the server a check of target failed the TLS handshake with, with any warnings.
+// err is the error of the check which names the URL it failed on after any redirects
+func inspectFailedTLS(err error, target *url.URL, roots *x509.CertPool) ([]configuration.PingCert, *configuration.TLSInfo, []string) {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		if failed, perr := url.Parse(uerr.URL); perr == nil && failed.Scheme == "https" {
+			target = failed
+		}
+	}
+	state, err := probeTLS(target, probeTimeout)
+	if err != nil { //the server could not be reached again or the handshake failed before any certificate was sent
+		return pingCerts(nil), nil, nil
+	}
+	info, warnings := inspectTLS(state, target.Hostname(), roots, time.Now())
+	return pingCerts(state), info, warnings
+}
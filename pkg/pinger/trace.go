@@ -0,0 +1,95 @@
+package pinger
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+//requestTrace holds the timings of a single HTTP check. A new one is used for every request so
+// nothing carries over from the previous check of a worker
+//
+//See https://stackoverflow.com/questions/48077098/getting-ttfb-time-to-first-byte-value-in-golang/48077762#48077762
+type requestTrace struct {
+	mu                        sync.Mutex //mu guards the fields as the dial callbacks may run on other goroutines
+	start                     time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn                   time.Time
+	wroteRequest              time.Time
+	firstByte                 time.Time
+	remoteIP                  string
+}
+
+//newRequestTrace starts the timing of a request from now
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now()}
+}
+
+//clientTrace returns the httptrace hooks that record into the requestTrace
+func (rt *requestTrace) clientTrace() *httptrace.ClientTrace {
+	mark := func(field *time.Time) {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		*field = time.Now()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&rt.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { mark(&rt.dnsDone) },
+		ConnectStart: func(network, addr string) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			if rt.connectStart.IsZero() { //dialing several addresses counts from the first attempt
+				rt.connectStart = time.Now()
+			}
+		},
+		ConnectDone:       func(network, addr string, err error) { mark(&rt.connectDone) },
+		TLSHandshakeStart: func() { mark(&rt.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { mark(&rt.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mark(&rt.gotConn)
+			if info.Conn == nil {
+				return
+			}
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				rt.mu.Lock()
+				rt.remoteIP = host
+				rt.mu.Unlock()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&rt.wroteRequest) },
+		GotFirstResponseByte: func() { mark(&rt.firstByte) },
+	}
+}
+
+//times returns the PingTimes of the request with end as the time the response body was read or the request failed.
+//Phases that did not happen are zero
+func (rt *requestTrace) times(end time.Time, protocol string) configuration.PingTimes {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return configuration.PingTimes{
+		DNS:              between(rt.dnsStart, rt.dnsDone),
+		TLSHandshake:     between(rt.tlsStart, rt.tlsDone),
+		Connect:          between(rt.connectStart, rt.connectDone),
+		FirstResponse:    between(rt.wroteRequest, rt.firstByte),
+		RequestWrite:     between(rt.gotConn, rt.wroteRequest),
+		ServerProcessing: between(rt.wroteRequest, rt.firstByte),
+		ContentTransfer:  between(rt.firstByte, end),
+		Total:            between(rt.start, end),
+		RemoteIP:         rt.remoteIP,
+		Protocol:         protocol,
+	}
+}
+
+//between returns the milliseconds from start to end, or zero if either did not happen
+func between(start, end time.Time) int64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Milliseconds()
+}
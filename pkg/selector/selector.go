@@ -0,0 +1,271 @@
+package selector
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+/*********************************************************
+selector is a minimal CSS selector implementation for
+picking elements out of HTML documents.
+
+Supports type (div), universal (*), #id, .class, [attr]
+and [attr=value] simple selectors combined into compound
+selectors such as div#main.banner[role=alert], joined by
+descendant (space) and child (>) combinators, with comma
+separated selector lists. Pseudo classes, sibling
+combinators and other attribute operators are not
+supported
+*********************************************************/
+
+//Selector is a parsed CSS selector list
+type Selector struct {
+	raw    string
+	groups [][]part
+}
+
+//part is a compound selector and the combinator joining it to the part before
+type part struct {
+	compound
+	child bool //child is whether the part must be a child rather than any descendant of the part before
+}
+
+//compound is a compound selector such as div#main.banner[role=alert]
+type compound struct {
+	tag     string //tag is the lower case element name. Empty for any element
+	id      string
+	classes []string
+	attrs   []attr
+}
+
+//attr is an attribute selector
+type attr struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+//Parse parses a CSS selector list
+func Parse(raw string) (Selector, error) {
+	out := Selector{raw: raw}
+	for _, group := range strings.Split(raw, ",") {
+		parts, err := parseGroup(group)
+		if err != nil {
+			return out, fmt.Errorf("invalid selector %q: %v", raw, err)
+		}
+		out.groups = append(out.groups, parts)
+	}
+	return out, nil
+}
+
+//String returns the selector as given to Parse
+func (sel Selector) String() string {
+	return sel.raw
+}
+
+//parseGroup parses a single selector of a selector list
+func parseGroup(group string) ([]part, error) {
+	parts := make([]part, 0)
+	child := false
+	for i := 0; i < len(group); {
+		switch group[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+			continue
+		case '>':
+			if len(parts) == 0 || child {
+				return nil, fmt.Errorf("misplaced > at %d", i)
+			}
+			child = true
+			i++
+			continue
+		}
+		c, next, err := parseCompound(group, i)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part{compound: c, child: child})
+		child = false
+		i = next
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	if child {
+		return nil, fmt.Errorf("selector ends with >")
+	}
+	return parts, nil
+}
+
+//parseCompound parses the compound selector starting at i of s and returns the index after it
+func parseCompound(s string, i int) (compound, int, error) {
+	var out compound
+	start := i
+	if s[i] == '*' {
+		i++
+	} else {
+		out.tag, i = readIdent(s, i)
+		out.tag = strings.ToLower(out.tag)
+	}
+	for i < len(s) {
+		var name string
+		switch s[i] {
+		case '#':
+			if name, i = readIdent(s, i+1); name == "" {
+				return out, i, fmt.Errorf("expected an id after # at %d", i)
+			}
+			out.id = name
+		case '.':
+			if name, i = readIdent(s, i+1); name == "" {
+				return out, i, fmt.Errorf("expected a class after . at %d", i)
+			}
+			out.classes = append(out.classes, name)
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return out, i, fmt.Errorf("unclosed [ at %d", i)
+			}
+			rule := attr{name: strings.ToLower(strings.TrimSpace(s[i+1 : i+end]))}
+			if eq := strings.IndexByte(rule.name, '='); eq >= 0 {
+				rule.value = strings.Trim(strings.TrimSpace(s[i+1 : i+end][eq+1:]), `"'`)
+				rule.name, rule.hasValue = strings.TrimSpace(rule.name[:eq]), true
+			}
+			if rule.name == "" || strings.ContainsAny(rule.name, "~|^$*") {
+				return out, i, fmt.Errorf("unsupported attribute selector %s", s[i:i+end+1])
+			}
+			out.attrs = append(out.attrs, rule)
+			i += end + 1
+		case ' ', '\t', '\n', '\r', '>':
+			return out, i, nil
+		default:
+			return out, i, fmt.Errorf("unsupported %q at %d", s[i], i)
+		}
+	}
+	if i == start {
+		return out, i, fmt.Errorf("expected a selector at %d", i)
+	}
+	return out, i, nil
+}
+
+//readIdent reads the CSS identifier starting at i of s and returns the index after it
+func readIdent(s string, i int) (string, int) {
+	start := i
+	for i < len(s) {
+		c := s[i]
+		if c == '-' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80 {
+			i++
+			continue
+		}
+		break
+	}
+	return s[start:i], i
+}
+
+//matches reports whether the element n meets the compound selector
+func (c compound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && attribute(n, "id") != c.id {
+		return false
+	}
+	classes := strings.Fields(attribute(n, "class"))
+	for _, class := range c.classes {
+		found := false
+		for _, have := range classes {
+			found = found || have == class
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, rule := range c.attrs {
+		value, ok := lookupAttribute(n, rule.name)
+		if !ok || rule.hasValue && value != rule.value {
+			return false
+		}
+	}
+	return true
+}
+
+//matchParts reports whether the element n meets the last of parts with its ancestors meeting the rest
+func matchParts(parts []part, n *html.Node) bool {
+	last := parts[len(parts)-1]
+	if !last.matches(n) {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	rest := parts[:len(parts)-1]
+	if last.child {
+		return n.Parent != nil && matchParts(rest, n.Parent)
+	}
+	for ancestor := n.Parent; ancestor != nil; ancestor = ancestor.Parent {
+		if matchParts(rest, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+//Select returns the elements below root matching the selector in document order.
+// Matches nested in another match are left out as they are part of it
+func (sel Selector) Select(root *html.Node) []*html.Node {
+	out := make([]*html.Node, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for _, group := range sel.groups {
+			if matchParts(group, n) {
+				out = append(out, n)
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return out
+}
+
+//Text returns the visible text of nodes, one line for each run of text, leaving out scripts and styles
+func Text(nodes ...*html.Node) string {
+	lines := make([]string, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript") {
+			return
+		}
+		if n.Type == html.TextNode {
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				lines = append(lines, text)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return strings.Join(lines, "\n")
+}
+
+//attribute returns the value of the attribute name of n, or empty if it has none
+func attribute(n *html.Node, name string) string {
+	value, _ := lookupAttribute(n, name)
+	return value
+}
+
+//lookupAttribute returns the value of the attribute name of n and whether it has it
+func lookupAttribute(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
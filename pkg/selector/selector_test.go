@@ -0,0 +1,46 @@
+package selector
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSelect(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body>
+		<div id="banner" class="alert warning" role="alert"><p>Degraded <b>API</b> performance</p><script>var t = 1</script></div>
+		<main><section class="status"><p>All systems</p><ul><li>Web</li><li class="down">Email</li></ul></section></main>
+		<footer><p>Updated 10:31</p></footer>
+	</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		selector string
+		want     string
+	}{
+		{"#banner", "Degraded\nAPI\nperformance"},
+		{"div.alert.warning[role=alert] p", "Degraded\nAPI\nperformance"},
+		{"[role='alert'] > b", ""},
+		{"section > p, li.down", "All systems\nEmail"},
+		{"main li", "Web\nEmail"},
+		{"* > ul > *", "Web\nEmail"},
+		{"P", "Degraded\nAPI\nperformance\nAll systems\nUpdated 10:31"},
+		{".missing", ""},
+	}
+	for _, tc := range cases {
+		sel, err := Parse(tc.selector)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.selector, err)
+		}
+		if got := Text(sel.Select(doc)...); got != tc.want {
+			t.Errorf("%s: got %q want %q", tc.selector, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "> p", "div >", "a:hover", "[href^=http]", "div[", "p + p", "#"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q not to parse", bad)
+		}
+	}
+}
@@ -13,9 +13,13 @@ import (
 //
 //Implemented via the web server in webhook.go
 func emailHandler(rw http.ResponseWriter, r *http.Request, ctx context.Context, validCheck chan<- validator, sender chan<- configuration.Transporter) {
-	//get json body
+	//get json body - kept to verify its signature
 	payload := &emailJSON{}
-	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+	body, ok := readInbound(rw, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, payload); err != nil {
 		//respond back with error message to display on the cloudmailin dashboard
 		rw.WriteHeader(http.StatusInternalServerError)
 		out := map[string]string{
@@ -24,31 +28,32 @@ func emailHandler(rw http.ResponseWriter, r *http.Request, ctx context.Context,
 		if err := json.NewEncoder(rw).Encode(out); err != nil {
 			log.Panicf("could not json encode error message for email mux: %v", err)
 		}
+		return
 	}
 	//Get corresponding config
-	validation := validator{
+	conf, ok := lookupConfig(ctx, validCheck, validator{
 		emailAddress: payload.Envelope.From, //should match config.
-		valid:        make(chan configuration.Config),
+	})
+	if !ok { //cancelled
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
 	}
-	validCheck <- validation
-
-	select { //allow for ctx cancel
-	case <-ctx.Done():
-		close(validCheck)
-		validCheck = nil
+	if conf.ServiceName == "" {
+		log.Printf("email update from %q matches no email status source", payload.Envelope.From)
+		return
+	}
+	//basic auth as set in cloudmailin, or any other InboundAuth check of the config
+	if !authoriseInbound(rw, r, body, conf) {
 		return
-	case conf := <-validation.valid:
-		if conf.ServiceName != "" {
-			if err := payload.Send(conf, sender); err != nil {
-				//respond back with error message to display on the cloudmailin dashboard
-				rw.WriteHeader(http.StatusInternalServerError)
-				out := map[string]string{
-					"error": err.Error(),
-				}
-				if err := json.NewEncoder(rw).Encode(out); err != nil {
-					log.Panicf("could not json encode error message for email mux: %v", err)
-				}
-			}
+	}
+	if err := payload.Send(conf, sender); err != nil {
+		//respond back with error message to display on the cloudmailin dashboard
+		rw.WriteHeader(http.StatusInternalServerError)
+		out := map[string]string{
+			"error": err.Error(),
+		}
+		if err := json.NewEncoder(rw).Encode(out); err != nil {
+			log.Panicf("could not json encode error message for email mux: %v", err)
 		}
 	}
 }
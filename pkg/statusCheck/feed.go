@@ -0,0 +1,439 @@
+package statuscheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+/*********************************************************
+feed.go reads status page feeds in any of the RSS 2.0,
+Atom and JSON Feed formats, telling them apart by their
+content rather than the URL or Content-Type, and turns
+each into the same feed of feedItems to send on
+*********************************************************/
+
+//maxFeedBytes is the most of a feed read
+const maxFeedBytes = 10 << 20
+
+//feedFormat is the format a feed was published in
+type feedFormat string
+
+const (
+	formatRSS      feedFormat = "rss"
+	formatAtom     feedFormat = "atom"
+	formatJSONFeed feedFormat = "jsonfeed"
+)
+
+//feed is a status page feed of any feedFormat
+type feed struct {
+	Format  feedFormat `json:"format"`
+	Title   string     `json:"title"`
+	Link    string     `json:"link"`
+	Updated time.Time  `json:"updated"` //Updated is when the feed was last changed. Zero if the feed does not say
+	Items   []feedItem `json:"items"`
+}
+
+//feedItem is a single entry of a feed. Implements Transports like rssItem
+type feedItem struct {
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	GUID  string `json:"guid"`
+	//Published is when the entry was last updated, or first published if it has never been updated
+	Published time.Time `json:"published"`
+	//Summary is a short version of the entry and Content the full text. Either may be nil
+	Summary *rssContent `json:"summary,omitempty"`
+	Content *rssContent `json:"content,omitempty"`
+
+	//dateErr is why the date of the item could not be read, if it could not
+	dateErr error
+	//undated is set when the item has no usable date so Published is the Updated time of the feed or the fetch time instead
+	undated bool
+}
+
+//key identifies the item within its feed
+func (item feedItem) key() string {
+	switch {
+	case item.GUID != "":
+		return item.GUID
+	case item.Link != "":
+		return item.Link
+	}
+	return item.Title
+}
+
+//getFeed fetches the feed at loc in any feedFormat
+func getFeed(loc string) (*feed, error) {
+	res, err := httpClient.Get(loc)
+	if err != nil {
+		return nil, fmt.Errorf("http.Client.Get error in getFeed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("feed %s answered %s", loc, res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxFeedBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed %s: %v", loc, err)
+	}
+	out, err := parseFeed(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse feed %s: %v", loc, err)
+	}
+	out.fillDates(loc, time.Now())
+	return out, nil
+}
+
+//fillDates gives the items without a usable date the Updated time of the feed, or fetched if it has none,
+// logging the dates that could not be read so the items are still sent on
+func (f *feed) fillDates(loc string, fetched time.Time) {
+	fallback := f.Updated
+	if fallback.IsZero() {
+		fallback = fetched
+	}
+	for i := range f.Items {
+		item := &f.Items[i]
+		if !item.Published.IsZero() {
+			continue
+		}
+		if item.dateErr != nil {
+			log.Printf("feed %s item %q has an unusable date, using %s instead: %v", loc, item.Title, fallback.Format(time.RFC3339), item.dateErr)
+		}
+		item.Published, item.undated = fallback, true
+	}
+}
+
+//parseFeed detects the feedFormat of body and parses it
+func parseFeed(body []byte) (*feed, error) {
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(body, []byte("{")) {
+		return parseJSONFeed(body)
+	}
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+	switch root.Local {
+	case "rss":
+		var out *rss
+		if err := xml.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("xml decode fail of rss feed: %v", err)
+		}
+		if err := out.normaliseXMLFormattedText(); err != nil {
+			return nil, err
+		}
+		return out.toFeed(), nil
+	case "feed":
+		var out atomFeed
+		if err := xml.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("xml decode fail of atom feed: %v", err)
+		}
+		return out.toFeed(), nil
+	}
+	return nil, fmt.Errorf("unsupported feed format with root element <%s>", root.Local)
+}
+
+//rootElement returns the name of the first element of an XML document
+func rootElement(body []byte) (xml.Name, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("feed is neither XML nor JSON: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+//GetLatest returns the items of the feed published after lastPubDate. Undated items are returned unless their key is in sent,
+// or if sent is nil as on the first fetch of the feed, when their stand-in date is after lastPubDate. See fillDates
+func (f feed) GetLatest(lastPubDate time.Time, sent map[string]bool) []feedItem {
+	out := make([]feedItem, 0)
+	for _, item := range f.Items {
+		switch {
+		case item.undated && sent != nil:
+			if !sent[item.key()] {
+				out = append(out, item)
+			}
+		case item.Published.After(lastPubDate):
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+//undatedKeys returns the keys of the undated items of the feed, to be given to GetLatest as sent on the next fetch
+func (f feed) undatedKeys() map[string]bool {
+	out := make(map[string]bool)
+	for _, item := range f.Items {
+		if item.undated {
+			out[item.key()] = true
+		}
+	}
+	return out
+}
+
+//LastUpdated returns when the feed was last changed: its Updated time or, if it has none, the latest dated item
+func (f feed) LastUpdated() time.Time {
+	latest := f.Updated
+	for _, item := range f.Items {
+		if !item.undated && item.Published.After(latest) {
+			latest = item.Published
+		}
+	}
+	return latest
+}
+
+//newContent returns the rssContent of raw, or nil if raw is empty
+func newContent(raw string) *rssContent {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	return &rssContent{Data: raw, Clean: normaliseXMLFormattedText(raw)}
+}
+
+//parseFeedDate parses an RFC3339 Atom or JSON Feed date, falling back to the RSS date formats. Zero without error if empty
+func parseFeedDate(date string) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return time.Time{}, nil
+	}
+	t, err := parseRSSDate(date, 0)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognised date %q", date)
+	}
+	return t, nil
+}
+
+//firstFeedDate returns the first of dates that is given and parses, or the error of the first that does not parse if none do
+func firstFeedDate(dates ...string) (time.Time, error) {
+	var firstErr error
+	for _, date := range dates {
+		t, err := parseFeedDate(date)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if !t.IsZero() {
+			return t, nil
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+//RSS -----------------------------------------------------------------------------------
+
+//toFeed returns the RSS feed as a feed
+func (rss rss) toFeed() *feed {
+	out := &feed{Format: formatRSS, Title: rss.Channel.Title, Link: rss.Channel.Link, Items: make([]feedItem, 0, len(rss.Channel.Items))}
+	out.Updated, _ = firstFeedDate(rss.Channel.PubDate, rss.Channel.LastBuildDate)
+	for _, item := range rss.Channel.Items {
+		entry := feedItem{
+			Title:   item.Title,
+			Link:    item.Link,
+			GUID:    item.GUID,
+			Summary: item.Description,
+			Content: item.ContentEncoded,
+		}
+		entry.Published, entry.dateErr = firstFeedDate(item.PubDate)
+		out.Items = append(out.Items, entry)
+	}
+	return out
+}
+
+//Atom ----------------------------------------------------------------------------------
+
+//atomFeed is an Atom (RFC 4287) feed
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   atomText    `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+//atomEntry is an entry of an atomFeed
+type atomEntry struct {
+	Title     atomText   `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   *atomText  `xml:"summary"`
+	Content   *atomText  `xml:"content"`
+}
+
+//atomLink is a link of an atomFeed or atomEntry
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+//atomText is an Atom text construct of type text, html or xhtml
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+//String returns the text, keeping the markup of xhtml
+func (text *atomText) String() string {
+	if text == nil {
+		return ""
+	}
+	if text.Type == "xhtml" {
+		return text.Inner
+	}
+	return text.Text
+}
+
+//Plain returns the text without markup, as for a title
+func (text *atomText) Plain() string {
+	if text == nil {
+		return ""
+	}
+	switch text.Type {
+	case "html":
+		return normaliseXMLFormattedText(text.Text)
+	case "xhtml":
+		var out strings.Builder
+		dec := xml.NewDecoder(strings.NewReader(text.Inner))
+		for {
+			token, err := dec.Token()
+			if err != nil {
+				break
+			}
+			if data, ok := token.(xml.CharData); ok {
+				out.Write(data)
+			}
+		}
+		return strings.Join(strings.Fields(out.String()), " ")
+	}
+	return strings.TrimSpace(text.Text)
+}
+
+//alternateLink returns the href of the alternate link, the default relation of a link without one
+func alternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+//toFeed returns the Atom feed as a feed
+func (atom atomFeed) toFeed() *feed {
+	out := &feed{
+		Format: formatAtom,
+		Title:  atom.Title.Plain(),
+		Link:   alternateLink(atom.Links),
+		Items:  make([]feedItem, 0, len(atom.Entries)),
+	}
+	out.Updated, _ = firstFeedDate(atom.Updated)
+	for _, entry := range atom.Entries {
+		item := feedItem{
+			Title:   entry.Title.Plain(),
+			Link:    alternateLink(entry.Links),
+			GUID:    entry.ID,
+			Summary: newContent(entry.Summary.String()),
+			Content: newContent(entry.Content.String()),
+		}
+		item.Published, item.dateErr = firstFeedDate(entry.Updated, entry.Published)
+		out.Items = append(out.Items, item)
+	}
+	return out
+}
+
+//JSON Feed -----------------------------------------------------------------------------
+
+//jsonFeed is a JSON Feed (https://jsonfeed.org) of version 1 or 1.1
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+//jsonFeedItem is an item of a jsonFeed
+type jsonFeedItem struct {
+	ID            json.RawMessage `json:"id"` //ID is a string but version 1 feeds are known to use numbers
+	URL           string          `json:"url"`
+	Title         string          `json:"title"`
+	ContentHTML   string          `json:"content_html"`
+	ContentText   string          `json:"content_text"`
+	Summary       string          `json:"summary"`
+	DatePublished string          `json:"date_published"`
+	DateModified  string          `json:"date_modified"`
+}
+
+//parseJSONFeed parses a JSON Feed
+func parseJSONFeed(body []byte) (*feed, error) {
+	var in jsonFeed
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, fmt.Errorf("json decode fail of json feed: %v", err)
+	}
+	if !strings.HasPrefix(in.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("json document is not a JSON Feed: version %q", in.Version)
+	}
+	out := &feed{Format: formatJSONFeed, Title: in.Title, Link: in.HomePageURL, Items: make([]feedItem, 0, len(in.Items))}
+	for _, entry := range in.Items {
+		item := feedItem{
+			Title:   entry.Title,
+			Link:    entry.URL,
+			GUID:    strings.Trim(string(entry.ID), `"`),
+			Summary: newContent(entry.Summary),
+			Content: newContent(entry.ContentHTML),
+		}
+		if item.Content == nil {
+			item.Content = newContent(entry.ContentText)
+		}
+		item.Published, item.dateErr = firstFeedDate(entry.DateModified, entry.DatePublished)
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+/**************************************************************************************************
+// Implement Transporter on feedItem
+**************************************************************************************************/
+
+//ToTransport creates a Transport object from the feedItem. Needed to implement Transports
+func (item feedItem) ToTransport(conf configuration.Config) (configuration.Transporter, error) {
+	t := configuration.Transporter{
+		DisplayServiceName: conf.ServiceName,
+		DisplayDomain:      conf.DisplayDomain,
+		MetaStatusPage:     conf.StatusPage,
+	}
+	//the full text if there is one, otherwise the summary, otherwise the title alone
+	switch {
+	case item.Content != nil:
+		t.Message, t.RawMessage = item.Content.Clean, item.Content.Data
+	case item.Summary != nil:
+		t.Message, t.RawMessage = item.Summary.Clean, item.Summary.Data
+	default:
+		t.Message, t.RawMessage = item.Title, item.Title
+	}
+	if !item.Published.IsZero() {
+		t.MessagePublishedDateTime = item.Published.Format(time.RFC3339)
+	}
+	return t, nil
+}
+
+//Send sends the feedItem to the next internal service using the standard Transporter format. Needed to implement Transports
+func (item feedItem) Send(conf configuration.Config, sender chan<- configuration.Transporter) error {
+	transport, err := item.ToTransport(conf)
+	if err != nil {
+		return err
+	}
+	sender <- transport
+	return nil
+}
@@ -0,0 +1,163 @@
+package statuscheck
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+var (
+	//inboundAccepted counts updates pushed to the webhook and email endpoints that passed verification by ServiceName
+	inboundAccepted = expvar.NewMap("inbound_accepted")
+	//inboundRejected counts updates pushed to the webhook and email endpoints that failed verification by ServiceName and reason
+	inboundRejected = expvar.NewMap("inbound_rejected")
+)
+
+//maxInboundBytes is the largest request body accepted by the webhook and email endpoints
+const maxInboundBytes = 1 << 20
+
+//Reasons an inbound update failed verification, as counted in inboundRejected
+const (
+	rejectIP        = "ip"
+	rejectSignature = "signature"
+	rejectBearer    = "bearer"
+	rejectBasic     = "basic"
+	rejectSecret    = "secret"
+)
+
+//inboundError is the reason an inbound update failed verification
+type inboundError struct {
+	reason string
+	err    error
+}
+
+func (ie *inboundError) Error() string {
+	return fmt.Sprintf("%s check failed: %v", ie.reason, ie.err)
+}
+
+//verifyInbound checks r with its already read body passes every check of the InboundAuth of conf.
+// Configs without an InboundAuth accept every request
+func verifyInbound(r *http.Request, body []byte, conf configuration.Config) *inboundError {
+	auth := conf.InboundAuth
+	if auth == nil {
+		return nil
+	}
+	if ip := clientIP(r, auth.TrustProxy); !auth.AllowsIP(ip) {
+		return &inboundError{rejectIP, fmt.Errorf("%v is not in allow_ips", ip)}
+	}
+	if auth.Bearer != "" {
+		want, err := auth.Bearer.Resolve()
+		if err != nil {
+			return &inboundError{rejectSecret, err}
+		}
+		token := r.Header.Get("Authorization")
+		if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") || !secretEqual(token[7:], want) {
+			return &inboundError{rejectBearer, fmt.Errorf("missing or wrong bearer token")}
+		}
+	}
+	if auth.Password != "" {
+		want, err := auth.Password.Resolve()
+		if err != nil {
+			return &inboundError{rejectSecret, err}
+		}
+		username, password, ok := r.BasicAuth()
+		//evaluate both so the time taken does not tell which was wrong
+		userOK, passwordOK := secretEqual(username, auth.Username), secretEqual(password, want)
+		if !ok || !userOK || !passwordOK {
+			return &inboundError{rejectBasic, fmt.Errorf("missing or wrong basic auth")}
+		}
+	}
+	if auth.SignatureSecret != "" {
+		key, err := auth.SignatureSecret.Resolve()
+		if err != nil {
+			return &inboundError{rejectSecret, err}
+		}
+		if err := verifySignature(r.Header.Get(auth.Header()), body, key); err != nil {
+			return &inboundError{rejectSignature, fmt.Errorf("%s: %v", auth.Header(), err)}
+		}
+	}
+	return nil
+}
+
+//verifySignature checks signature is the hex encoded HMAC-SHA256 of body with key, with or without a sha256= prefix
+func verifySignature(signature string, body []byte, key string) error {
+	signature = strings.TrimSpace(signature)
+	if signature == "" {
+		return fmt.Errorf("no signature")
+	}
+	if len(signature) > 7 && strings.EqualFold(signature[:7], "sha256=") {
+		signature = signature[7:]
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("signature is not hex encoded")
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("signature does not match the body")
+	}
+	return nil
+}
+
+//secretEqual compares got with want in constant time
+func secretEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+//clientIP is the IP r came from. With trustProxy it is the last X-Forwarded-For entry, the one added by the proxy itself
+func clientIP(r *http.Request, trustProxy bool) net.IP {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+//readInbound reads the body of r, which must be no larger than maxInboundBytes as it is read before it is verified.
+// Larger bodies are answered with 413 and unreadable ones with 400 and false is returned
+func readInbound(rw http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxInboundBytes))
+	if err == nil {
+		return body, true
+	}
+	status := http.StatusBadRequest
+	if len(body) >= maxInboundBytes { //MaxBytesReader fails once the limit is read
+		status = http.StatusRequestEntityTooLarge
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(map[string]string{"error": fmt.Sprintf("could not read update: %v", err)})
+	return nil, false
+}
+
+//authoriseInbound verifies r for conf, counting the outcome. Failed requests are answered with 401 and false is returned
+func authoriseInbound(rw http.ResponseWriter, r *http.Request, body []byte, conf configuration.Config) bool {
+	if err := verifyInbound(r, body, conf); err != nil {
+		inboundRejected.Add(conf.ServiceName+"/"+err.reason, 1)
+		log.Printf("update for %s rejected: %v", conf.ServiceName, err)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(rw).Encode(map[string]string{"error": "unauthorised"})
+		return false
+	}
+	inboundAccepted.Add(conf.ServiceName, 1)
+	return true
+}
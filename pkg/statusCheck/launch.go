@@ -11,11 +11,12 @@ import (
 //Launch quickly launches status check operations - takes a context.Context with cancel
 func Launch(ctx context.Context, configChan <-chan *configuration.Configuration) {
 	directory := directory{
-		configChan:  configChan,
-		cancel:      ctx.Done(),
-		rssChan:     make(chan configuration.Config),
-		twitterChan: make(chan configuration.Config),
-		sender:      make(chan configuration.Transporter),
+		configChan:     configChan,
+		cancel:         ctx.Done(),
+		rssChan:        make(chan configuration.Config),
+		twitterChan:    make(chan configuration.Config),
+		statuspageChan: make(chan configuration.Config),
+		sender:         make(chan configuration.Transporter),
 		validators: validators{
 			webhook: make(chan validator),
 			email:   make(chan validator),
@@ -27,16 +28,18 @@ func Launch(ctx context.Context, configChan <-chan *configuration.Configuration)
 	go runStatusWebhookServer(ctx, directory.validators, directory.sender) //also acts as server for email incoming updates
 	go runRSSOperations(directory.rssChan, directory.sender)               //pulls RSS updates periodically
 	go runTwitterOperations(directory.twitterChan, directory.sender)       //pulls Twitter updates periodically
+	go runStatuspageOperations(directory.statuspageChan, directory.sender) //pulls Statuspage API incidents periodically
 }
 
 //directory is a wrapper around all the goroutines handled by operator and spun up at Launch
 type directory struct {
-	configChan  <-chan *configuration.Configuration
-	cancel      <-chan struct{}
-	rssChan     chan configuration.Config
-	twitterChan chan configuration.Config
-	sender      chan configuration.Transporter //sender sends outgoing Transporters to a single http.Client for conn keep-alive efficiencies
-	validators  validators
+	configChan     <-chan *configuration.Configuration
+	cancel         <-chan struct{}
+	rssChan        chan configuration.Config
+	twitterChan    chan configuration.Config
+	statuspageChan chan configuration.Config
+	sender         chan configuration.Transporter //sender sends outgoing Transporters to a single http.Client for conn keep-alive efficiencies
+	validators     validators
 }
 
 //validators houses the channels used by run functions to send fragments of info to operator function and
@@ -56,4 +59,7 @@ func (dir directory) closePush() {
 
 	close(dir.twitterChan)
 	dir.twitterChan = nil
+
+	close(dir.statuspageChan)
+	dir.statuspageChan = nil
 }
@@ -26,40 +26,31 @@ format using standardised protocols
 
 //Primary goroutine -------------------------------------------------------------------
 
-//runRSSOperations is the main function that receives a config item and fetches a status update via an RSS feed
+//runRSSOperations is the main function that receives a config item and fetches a status update via an RSS, Atom or JSON feed
 //  before handing off to other services
 func runRSSOperations(c <-chan configuration.Config, sender chan<- configuration.Transporter) {
-	services := make(map[string]time.Time) //serviceName against last publish date on the Channel.pubdate(of lastBuildDate if pubdate is blank)
+	services := make(map[string]time.Time)          //feed URL against the time the feed was last updated
+	undatedSent := make(map[string]map[string]bool) //feed URL against the keys of the undated items already sent
 	for config := range c {
 		_, l := config.ParseServiceInfo()
-		feed, err := getRSSFeed(l)
+		feed, err := getFeed(l)
 		if err != nil {
 			log.Panicln(err)
 		}
-		// TODO: parse the rss response and send each relevent *rssItem object somewhere for processing and storage
-		lastPubDate, ok := services[config.ServiceName]
+		lastPubDate, ok := services[l]
 		if !ok {
 			lastPubDate = time.Now().Add(-24 * time.Hour)
 		}
-		feedItems, err := feed.GetLatest(lastPubDate, &config)
-		if err != nil {
-			log.Panicln(err)
-		}
-		for _, feedItem := range feedItems {
+		for _, feedItem := range feed.GetLatest(lastPubDate, undatedSent[l]) {
 			feedItem.Send(config, sender)
 		}
+		undatedSent[l] = feed.undatedKeys()
 
-		d := feed.Channel.PubDate
-		if d == "" {
-			d = feed.Channel.LastBuildDate
-		}
-
-		t, err := parseRSSDate(d, 0)
-		if err != nil {
-			log.Panicln(err)
+		if updated := feed.LastUpdated(); updated.After(lastPubDate) {
+			services[l] = updated
+		} else {
+			services[l] = lastPubDate
 		}
-
-		services[config.ServiceName] = t
 	}
 }
 
@@ -99,23 +90,6 @@ func getRSSFeed(loc string) (*rss, error) {
 	return out, nil
 }
 
-//GetLatest aggregates the rssItems since the last fetch that needs to be sent on to the next service
-func (rss rss) GetLatest(lastPubDate time.Time, config *configuration.Config) ([]rssItem, error) {
-	out := make([]rssItem, 0)
-	for _, item := range rss.Channel.Items {
-		t, err := parseRSSDate(item.PubDate, 0)
-		if err != nil {
-			return nil, err
-		}
-
-		if t.After(lastPubDate) {
-			out = append(out, item)
-		}
-
-	}
-	return out, nil
-}
-
 //Response formatting -----------------------------------------------------------------------
 
 //normaliseXMLFormattedText removes the HTML encodings and returns human readable plain text
@@ -216,44 +190,3 @@ func toJSON(rss interface{}) ([]byte, error) {
 	}
 	return jenc.Bytes(), nil
 }
-
-/**************************************************************************************************
-// Implement Transporter on RSSItem
-**************************************************************************************************/
-
-//ToTransport creates a Transport object from the RSSItem. Needed to implement Transports
-func (rssItem rssItem) ToTransport(conf configuration.Config) (configuration.Transporter, error) {
-	t := configuration.Transporter{
-		DisplayServiceName:       conf.ServiceName,
-		DisplayDomain:            conf.DisplayDomain,
-		Message:                  rssItem.ContentEncoded.Clean,
-		RawMessage:               rssItem.ContentEncoded.Data,
-		MessagePublishedDateTime: rssItem.PubDate,
-		MetaStatusPage:           conf.StatusPage,
-	}
-	//Give Description is ContentEncoded is empty (standard says if both are present description is summary and content encoded is full text)
-	if t.Message == "" {
-		t.Message = rssItem.Description.Clean
-		t.RawMessage = rssItem.Description.Data
-	}
-	//Format MessagePublishedTime to RFC3339. RSS2.0 uses RFC822 as standard. See http://validator.w3.org/feed/docs/rss2.html
-	if t.MessagePublishedDateTime != "" {
-		w, err := parseRSSDate(t.MessagePublishedDateTime, 0)
-		if err != nil {
-			return t, err
-		}
-
-		t.MessagePublishedDateTime = w.Format(time.RFC3339)
-	}
-	return t, nil
-}
-
-//Send sends the RSSItem to the next internal service using the standard Transporter format. Needed to implement Transports
-func (rssItem rssItem) Send(conf configuration.Config, sender chan<- configuration.Transporter) error {
-	transport, err := rssItem.ToTransport(conf)
-	if err != nil {
-		return err
-	}
-	sender <- transport
-	return nil
-}
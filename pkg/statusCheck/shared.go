@@ -1,9 +1,11 @@
 package statuscheck
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/karlsburg87/statusSentry/pkg/configuration"
@@ -56,17 +58,71 @@ type validator struct {
 	valid        chan configuration.Config //valid is the response channel with a bool signalling true if valid service update
 	serviceName  string
 	emailAddress string
+	path         string //path is the request path of a webhook update, matched against the custom paths of webhook status sources
 }
 
+//lookupConfig asks the operator for the Config toValidate is for, returning false if ctx is cancelled first.
+// toValidate.valid is buffered so the operator never waits on a caller that has gone
+func lookupConfig(ctx context.Context, validCheck chan<- validator, toValidate validator) (configuration.Config, bool) {
+	toValidate.valid = make(chan configuration.Config, 1)
+	select {
+	case <-ctx.Done():
+		return configuration.Config{}, false
+	case validCheck <- toValidate:
+	}
+	select {
+	case <-ctx.Done():
+		return configuration.Config{}, false
+	case conf := <-toValidate.valid:
+		return conf, true
+	}
+}
+
+//matchWebhook returns the webhook config toValidate is for, first by its custom path then by its case-insensitive
+// service name, or an empty Config if none match
+func matchWebhook(configs configuration.Configuration, toValidate validator) configuration.Config {
+	if toValidate.path != "" {
+		for _, item := range configs {
+			if _, path := item.WebhookSource(); path != "" && strings.TrimSuffix(path, "/") == toValidate.path {
+				return item
+			}
+		}
+	}
+	if toValidate.serviceName != "" {
+		for _, item := range configs {
+			if strings.EqualFold(strings.TrimSpace(item.ServiceName), toValidate.serviceName) {
+				return item
+			}
+		}
+	}
+	return configuration.Config{}
+}
+
+//matchEmail returns the email config with the sender address of toValidate, or an empty Config if none match
+func matchEmail(configs configuration.Configuration, toValidate validator) configuration.Config {
+	for _, item := range configs {
+		if _, senderAddress := item.ParseServiceInfo(); senderAddress == toValidate.emailAddress {
+			return item
+		}
+	}
+	return configuration.Config{}
+}
+
+//minPullInterval is the shortest interval between pulls of a single PULL type status source
+const minPullInterval = 3 * time.Minute
+
 //operator orchestrates configMap updating and status Pulls to avoid data races in configmap updates
 //
 //Effectively the central function of the package
 func operator(dir directory) {
 	var configMap map[configuration.ServiceType]configuration.Configuration
+	var current *configuration.Configuration
 	var err error
+	//lastPull is the time each service was last pulled by ServiceName. Kept across config reloads for unchanged services
+	lastPull := make(map[string]time.Time)
 
-	//How often to check pull updates
-	tckr := time.NewTicker(3 * time.Minute)
+	//How often to check pull updates are due
+	tckr := time.NewTicker(30 * time.Second)
 
 	for {
 		select {
@@ -80,27 +136,32 @@ func operator(dir directory) {
 			if err != nil {
 				log.Panicln(err)
 			}
-
-		case toValidate := <-dir.validators.webhook: //validation of incoming webhook messages - returns the relevant config
-			for _, item := range configMap[configuration.ServiceWebhook] {
-				if item.ServiceName == toValidate.serviceName {
-					toValidate.valid <- item
-					continue
+			//removed services stop being pulled and services with a new source are pulled afresh
+			diff := configuration.DiffConfigurations(current, conf)
+			for _, name := range diff.Removed {
+				delete(lastPull, name)
+			}
+			for _, changed := range diff.Changed {
+				if changed.HasField("status_source") {
+					delete(lastPull, changed.ServiceName)
 				}
 			}
-			toValidate.valid <- configuration.Config{} //send default empty struct if not valid
+			current = conf
+			log.Printf("status check config updated: %s", diff)
+
+		case toValidate := <-dir.validators.webhook: //validation of incoming webhook messages - returns the relevant config
+			//exactly one reply as the handler only reads one - the empty struct if not valid
+			toValidate.valid <- matchWebhook(configMap[configuration.ServiceWebhook], toValidate)
 
 		case toValidate := <-dir.validators.email:
-			for _, item := range configMap[configuration.ServiceEmail] {
-				if _, senderAddress := item.ParseServiceInfo(); senderAddress == toValidate.emailAddress {
-					toValidate.valid <- item
-				}
-			}
-			toValidate.valid <- configuration.Config{}
+			toValidate.valid <- matchEmail(configMap[configuration.ServiceEmail], toValidate)
 
-		case <-tckr.C: //cron to run through the PULL service type update operations
+		case now := <-tckr.C: //cron to run through the PULL service type update operations
 			for channelType, entries := range configMap {
 				for _, entry := range entries {
+					if !isPullDue(entry, lastPull[entry.ServiceName], now) {
+						continue
+					}
 					switch channelType {
 					case configuration.ServiceRSS:
 						dir.rssChan <- entry
@@ -109,9 +170,25 @@ func operator(dir directory) {
 							continue
 						}
 						dir.twitterChan <- entry
+					case configuration.ServiceStatuspage:
+						dir.statuspageChan <- entry
+					default:
+						continue
 					}
+					lastPull[entry.ServiceName] = now
 				}
 			}
 		}
 	}
 }
+
+//isPullDue reports whether a PULL type entry last pulled at lastPull should be pulled at now.
+//
+//Entries are pulled every PollFrequency but no more often than minPullInterval
+func isPullDue(entry configuration.Config, lastPull, now time.Time) bool {
+	interval := time.Duration(entry.PollFrequency)
+	if interval < minPullInterval {
+		interval = minPullInterval
+	}
+	return !lastPull.Add(interval).After(now)
+}
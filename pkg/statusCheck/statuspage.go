@@ -0,0 +1,173 @@
+package statuscheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+/*********************************************************
+statuspage.go reads incidents from the API of Atlassian
+Statuspage pages, keeping the component and impact data
+the history feed loses.
+
+See https://metastatuspage.com/api
+*********************************************************/
+
+//Primary goroutine -------------------------------------------------------------------
+
+//runStatuspageOperations is the main function that receives a config item and fetches the incidents updated since the
+// last fetch from the Statuspage API before handing off to other services
+func runStatuspageOperations(c <-chan configuration.Config, sender chan<- configuration.Transporter) {
+	services := make(map[string]time.Time) //page URL against the latest incident update already sent
+	for config := range c {
+		_, page := config.ParseServiceInfo()
+		incidents, err := getStatuspageIncidents(page)
+		if err != nil { //a page that cannot be reached is tried again at the next pull
+			log.Println(err)
+			continue
+		}
+		lastUpdate, ok := services[page]
+		if !ok {
+			lastUpdate = time.Now().Add(-24 * time.Hour)
+		}
+		latest := lastUpdate
+		for _, incident := range incidents {
+			updated, err := time.Parse(time.RFC3339, incident.UpdatedAt)
+			if err != nil || !updated.After(lastUpdate) {
+				continue
+			}
+			if err := incident.Send(config, sender); err != nil {
+				log.Printf("error on Incident.Send for %s and error : %v", page, err)
+			}
+			if updated.After(latest) {
+				latest = updated
+			}
+		}
+		services[page] = latest
+	}
+}
+
+//top level functions ------------------------------------------------------------------
+
+//getStatuspageIncidents fetches the recent incidents of the Statuspage at page with the current status of their components
+func getStatuspageIncidents(page string) ([]configuration.Incident, error) {
+	page = strings.TrimSuffix(page, "/")
+	var incidents statuspageIncidents
+	if err := getStatuspageJSON(page+"/api/v2/incidents.json", &incidents); err != nil {
+		return nil, err
+	}
+	var components statuspageComponents
+	if err := getStatuspageJSON(page+"/api/v2/components.json", &components); err != nil {
+		return nil, err
+	}
+	//components by ID for their current status and group name
+	byID := make(map[string]statuspageComponent)
+	for _, component := range components.Components {
+		byID[component.ID] = component
+	}
+	out := make([]configuration.Incident, 0, len(incidents.Incidents))
+	for _, raw := range incidents.Incidents {
+		var incident statuspageIncident
+		if err := json.Unmarshal(raw, &incident); err != nil {
+			return nil, fmt.Errorf("could not parse incident of %s: %v", page, err)
+		}
+		out = append(out, incident.toIncident(byID, string(raw)))
+	}
+	return out, nil
+}
+
+//getStatuspageJSON decodes the JSON response of the Statuspage API at loc into out
+func getStatuspageJSON(loc string, out interface{}) error {
+	res, err := httpClient.Get(loc)
+	if err != nil {
+		return fmt.Errorf("http.Client.Get error in getStatuspageJSON: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("statuspage API %s answered %s", loc, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("json decode fail of %s: %v", loc, err)
+	}
+	return nil
+}
+
+/*****************************************************************************************
+* Statuspage API types
+*****************************************************************************************/
+
+//statuspageIncidents is the response of /api/v2/incidents.json. Incidents are kept raw to send on as received
+type statuspageIncidents struct {
+	Incidents []json.RawMessage `json:"incidents"`
+}
+
+//statuspageIncident is an incident of the Statuspage API
+type statuspageIncident struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Status     string                `json:"status"`
+	Impact     string                `json:"impact"`
+	Shortlink  string                `json:"shortlink"`
+	CreatedAt  string                `json:"created_at"`
+	UpdatedAt  string                `json:"updated_at"`
+	ResolvedAt string                `json:"resolved_at"`
+	Components []statuspageComponent `json:"components"`
+	Updates    []struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		Body      string `json:"body"`
+		CreatedAt string `json:"created_at"`
+	} `json:"incident_updates"`
+}
+
+//statuspageComponents is the response of /api/v2/components.json
+type statuspageComponents struct {
+	Components []statuspageComponent `json:"components"`
+}
+
+//statuspageComponent is a component of the Statuspage API. Groups of components are components too
+type statuspageComponent struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	GroupID string `json:"group_id"`
+}
+
+//toIncident returns the Incident with the current status of its components from byID
+func (in statuspageIncident) toIncident(byID map[string]statuspageComponent, raw string) configuration.Incident {
+	out := configuration.Incident{
+		ID:         in.ID,
+		Name:       in.Name,
+		Status:     in.Status,
+		Impact:     in.Impact,
+		URL:        in.Shortlink,
+		CreatedAt:  in.CreatedAt,
+		UpdatedAt:  in.UpdatedAt,
+		ResolvedAt: in.ResolvedAt,
+		Components: make([]configuration.IncidentComponent, 0, len(in.Components)),
+		Updates:    make([]configuration.IncidentUpdate, 0, len(in.Updates)),
+		Source:     string(configuration.ServiceStatuspage),
+		Raw:        raw,
+	}
+	for _, component := range in.Components {
+		if current, ok := byID[component.ID]; ok {
+			component = current
+		}
+		out.Components = append(out.Components, configuration.IncidentComponent{
+			ID:     component.ID,
+			Name:   component.Name,
+			Group:  byID[component.GroupID].Name,
+			Status: component.Status,
+		})
+	}
+	for _, update := range in.Updates {
+		out.Updates = append(out.Updates, configuration.IncidentUpdate{ID: update.ID, Status: update.Status, Body: update.Body, CreatedAt: update.CreatedAt})
+	}
+	return out
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -18,52 +18,80 @@ import (
 //newMux is a multiplexer that serves status webhook routes to the correct handling function
 func newMux(ctx context.Context, validCheckWebhook chan<- validator, validCheckEmail chan<- validator, sender chan<- configuration.Transporter) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, "Welcome to Status Sentry") })
-	mux.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		//check incoming for service name identifiers
-		identifier := r.URL.Path //the path of format "/webhook/$ServiceName" which must correspond to the ServiceName in the config
-		//match with config to ensure it is a valid update
-		validation := validator{
-			serviceName: strings.Split(identifier, "/")[len(identifier)-1], //the path has format "/webhook/$ServiceName"
-			valid:       make(chan configuration.Config),
-		}
-		validCheckWebhook <- validation
-
-		select { //allow for ctx cancel
-		case <-ctx.Done():
-			close(validCheckWebhook)
-			validCheckWebhook = nil
-			return
-		case item := <-validation.valid:
-			if item.ServiceName != "" {
-				//parse and do something with the match and the webhook info - decode json and use
-				body, err := io.ReadAll(r.Body)
-				if err != nil {
-					log.Panicln(err)
-				}
-				if err := (webhookReceive{message: string(body)}).Send(item, sender); err != nil {
-					log.Panicln(err)
-				}
-				return
-			}
-			//else log error
-			toDebug := make(map[string]interface{})
-			json.NewDecoder(r.Body).Decode(&toDebug)
-			log.Printf("Update received deemed to be non valid: %+v\n", toDebug)
-		}
-
-	})
+	//webhook updates arrive at /webhook/${ServiceName} or the custom path of their status source so every path is routed
+	mux.HandleFunc("/", webhookHandler(ctx, validCheckWebhook, sender))
 
 	//Also be alive to email JSON alerts from cloudmailin - email.go for logic
 	mux.HandleFunc("/email", func(w http.ResponseWriter, r *http.Request) {
-		//TODO: Basic Auth check
 		emailHandler(w, r, ctx, validCheckEmail, sender)
 	})
 
 	return mux
 }
 
+//webhookHandler routes webhook updates to the matching webhook Config, answering 202 once the update is sent on,
+// 404 if no Config matches the path and 405 for methods other than POST
+func webhookHandler(ctx context.Context, validCheck chan<- validator, sender chan<- configuration.Transporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, "Welcome to Status Sentry")
+			return
+		}
+		//match with config to ensure it is a valid update
+		serviceName, path := webhookRoute(r.URL)
+		item, ok := lookupConfig(ctx, validCheck, validator{serviceName: serviceName, path: path})
+		if !ok { //cancelled
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if item.ServiceName == "" {
+			log.Printf("Update received at %s matches no webhook status source\n", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "webhook updates must be POSTed", http.StatusMethodNotAllowed)
+			return
+		}
+		//parse and do something with the match and the webhook info - decode json and use
+		body, ok := readInbound(w, r)
+		if !ok {
+			return
+		}
+		if !authoriseInbound(w, r, body, item) {
+			return
+		}
+		if err := decodeWebhook(item, body).Send(item, sender); err != nil {
+			log.Panicln(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+	}
+}
+
+//webhookRoute returns the URL decoded service name of a /webhook/${ServiceName} path, empty for other paths,
+// and the path without a trailing slash to match the custom paths of webhook status sources
+func webhookRoute(uri *url.URL) (serviceName string, path string) {
+	path = strings.TrimSuffix(uri.Path, "/")
+	//work from the escaped path so an encoded "/" in the service name is not taken as a separator
+	escaped := strings.TrimSuffix(uri.EscapedPath(), "/")
+	if !strings.HasPrefix(escaped, "/webhook/") {
+		return "", path
+	}
+	segment := strings.TrimPrefix(escaped, "/webhook/")
+	if strings.Contains(segment, "/") {
+		return "", path
+	}
+	name, err := url.PathUnescape(segment)
+	if err != nil {
+		return "", path
+	}
+	return strings.TrimSpace(name), path
+}
+
 //runStatusWebhookServer is a goroutine for handling webhook status updates
 func runStatusWebhookServer(ctx context.Context, validCheck validators, sender chan<- configuration.Transporter) {
 	var err error
@@ -0,0 +1,216 @@
+package statuscheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/karlsburg87/statusSentry/pkg/configuration"
+)
+
+/*********************************************************
+webhookdecode.go turns the webhook payloads of status page
+vendors into structured Incidents. The decoder is chosen
+by the WebhookFormat of the Config the webhook is for.
+Payloads of the raw format, or that fail to decode, are
+sent on as received
+*********************************************************/
+
+//webhookDecoder decodes a webhook payload into an Incident
+type webhookDecoder func(body []byte) (configuration.Incident, error)
+
+//webhookDecoders are the decoders of each WebhookFormat. WebhookRaw has none
+var webhookDecoders = map[configuration.WebhookFormat]webhookDecoder{
+	configuration.WebhookStatuspage: decodeStatuspageWebhook,
+	configuration.WebhookIncidentIO: decodeIncidentIOWebhook,
+	configuration.WebhookInstatus:   decodeInstatusWebhook,
+}
+
+//decodeWebhook returns the update of the webhook body for conf: an Incident if its format has a decoder, otherwise the raw body
+func decodeWebhook(conf configuration.Config, body []byte) configuration.Transports {
+	format, _ := conf.WebhookSource()
+	decode, ok := webhookDecoders[format]
+	if !ok {
+		return webhookReceive{message: string(body)}
+	}
+	incident, err := decode(body)
+	if err != nil {
+		log.Printf("could not decode %s webhook for %s, sending it raw: %v", format, conf.ServiceName, err)
+		return webhookReceive{message: string(body)}
+	}
+	incident.Source = string(format)
+	incident.Raw = string(body)
+	return incident
+}
+
+//Statuspage --------------------------------------------------------------------------
+
+//statuspageWebhook is an Atlassian Statuspage subscriber webhook of an incident or of a component update
+type statuspageWebhook struct {
+	Incident  *statuspageIncident  `json:"incident"`
+	Component *statuspageComponent `json:"component"`
+}
+
+//decodeStatuspageWebhook decodes an Atlassian Statuspage webhook. The incident has the same shape as in the Statuspage API
+func decodeStatuspageWebhook(body []byte) (configuration.Incident, error) {
+	var payload statuspageWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return configuration.Incident{}, err
+	}
+	switch {
+	case payload.Incident != nil:
+		return payload.Incident.toIncident(nil, ""), nil
+	case payload.Component != nil:
+		return componentIncident(configuration.IncidentComponent{
+			ID:     payload.Component.ID,
+			Name:   payload.Component.Name,
+			Status: payload.Component.Status,
+		}), nil
+	}
+	return configuration.Incident{}, fmt.Errorf("payload has neither an incident nor a component")
+}
+
+//componentIncident returns the update of a single component as an Incident named for the component
+func componentIncident(component configuration.IncidentComponent) configuration.Incident {
+	return configuration.Incident{
+		ID:         component.ID,
+		Name:       component.Name,
+		Status:     component.Status,
+		Components: []configuration.IncidentComponent{component},
+	}
+}
+
+//incident.io -------------------------------------------------------------------------
+
+//incidentIOIncident is the public incident of an incident.io status page webhook
+type incidentIOIncident struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Status             string `json:"status"`
+	URL                string `json:"url"`
+	CreatedAt          string `json:"created_at"`
+	UpdatedAt          string `json:"updated_at"`
+	AffectedComponents []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"affected_components"`
+	Message string `json:"message"`
+}
+
+//incidentIOImpact is the impact of the worst component status of an incident.io incident, in rising order
+var incidentIOImpact = []struct{ status, impact string }{
+	{"degraded_performance", "minor"},
+	{"partial_outage", "major"},
+	{"full_outage", "critical"},
+}
+
+//decodeIncidentIOWebhook decodes an incident.io status page webhook. The incident is found under the key named by its event_type
+// e.g. {"event_type": "public_incident.incident_created_v2", "public_incident.incident_created_v2": {...}}
+func decodeIncidentIOWebhook(body []byte) (configuration.Incident, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return configuration.Incident{}, err
+	}
+	var eventType string
+	if err := json.Unmarshal(payload["event_type"], &eventType); err != nil || eventType == "" {
+		return configuration.Incident{}, fmt.Errorf("payload has no event_type")
+	}
+	var in incidentIOIncident
+	if err := json.Unmarshal(payload[eventType], &in); err != nil {
+		return configuration.Incident{}, fmt.Errorf("payload has no %s: %v", eventType, err)
+	}
+	out := configuration.Incident{
+		ID:        in.ID,
+		Name:      in.Name,
+		Status:    in.Status,
+		URL:       in.URL,
+		CreatedAt: in.CreatedAt,
+		UpdatedAt: in.UpdatedAt,
+	}
+	//incident.io has no impact of its own so it is taken from the worst affected component
+	worst := -1
+	for _, component := range in.AffectedComponents {
+		out.Components = append(out.Components, configuration.IncidentComponent{ID: component.ID, Name: component.Name, Status: component.Status})
+		for i, level := range incidentIOImpact {
+			if component.Status == level.status && i > worst {
+				worst = i
+			}
+		}
+	}
+	if worst >= 0 {
+		out.Impact = incidentIOImpact[worst].impact
+	}
+	if in.Message != "" {
+		out.Updates = []configuration.IncidentUpdate{{Status: in.Status, Body: in.Message, CreatedAt: in.UpdatedAt}}
+	}
+	return out, nil
+}
+
+//Instatus ----------------------------------------------------------------------------
+
+//instatusWebhook is an Instatus subscriber webhook of an incident or of a component update
+type instatusWebhook struct {
+	Incident *struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		Impact     string `json:"impact"`
+		URL        string `json:"url"`
+		CreatedAt  string `json:"created_at"`
+		UpdatedAt  string `json:"updated_at"`
+		ResolvedAt string `json:"resolved_at"`
+		Components []struct {
+			ID     string `json:"id"`
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"components"`
+		Updates []struct {
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			Body      string `json:"body"`
+			CreatedAt string `json:"created_at"`
+		} `json:"incident_updates"`
+	} `json:"incident"`
+	Component *struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"component"`
+}
+
+//decodeInstatusWebhook decodes an Instatus webhook. Instatus statuses such as MAJOROUTAGE are lower cased
+func decodeInstatusWebhook(body []byte) (configuration.Incident, error) {
+	var payload instatusWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return configuration.Incident{}, err
+	}
+	switch in := payload.Incident; {
+	case in != nil:
+		out := configuration.Incident{
+			ID:         in.ID,
+			Name:       in.Name,
+			Status:     strings.ToLower(in.Status),
+			Impact:     strings.ToLower(in.Impact),
+			URL:        in.URL,
+			CreatedAt:  in.CreatedAt,
+			UpdatedAt:  in.UpdatedAt,
+			ResolvedAt: in.ResolvedAt,
+		}
+		for _, component := range in.Components {
+			out.Components = append(out.Components, configuration.IncidentComponent{ID: component.ID, Name: component.Name, Status: strings.ToLower(component.Status)})
+		}
+		for _, update := range in.Updates {
+			out.Updates = append(out.Updates, configuration.IncidentUpdate{ID: update.ID, Status: strings.ToLower(update.Status), Body: update.Body, CreatedAt: update.CreatedAt})
+		}
+		return out, nil
+	case payload.Component != nil:
+		return componentIncident(configuration.IncidentComponent{
+			ID:     payload.Component.ID,
+			Name:   payload.Component.Name,
+			Status: strings.ToLower(payload.Component.Status),
+		}), nil
+	}
+	return configuration.Incident{}, fmt.Errorf("payload has neither an incident nor a component")
+}